@@ -7,12 +7,17 @@ import (
 	"os/signal"
 	"syscall"
 	"tg-bot-voice-to-text/internal/vtt"
+	"tg-bot-voice-to-text/internal/vtt/i18n"
+	"tg-bot-voice-to-text/internal/vtt/settings"
 	"tg-bot-voice-to-text/internal/vtt/stt"
 	"tg-bot-voice-to-text/pkg/botwork"
+	"tg-bot-voice-to-text/pkg/breaker"
 	"tg-bot-voice-to-text/pkg/cache"
+	"tg-bot-voice-to-text/pkg/health"
 	"tg-bot-voice-to-text/pkg/queue"
 	"tg-bot-voice-to-text/pkg/scheduler"
 	"tg-bot-voice-to-text/pkg/setup"
+	"time"
 
 	lru "github.com/hashicorp/golang-lru/v2"
 	"go.uber.org/zap"
@@ -54,33 +59,173 @@ func main() {
 	logger.Debug("Creating worker scheduler")
 	sched := scheduler.NewNamedWorkerSchedulerQueue(ctx, queue)
 
-	logger.Info("Setting up file ID cache", zap.Int("size", cfg.CacheSize))
 	var fileIDCache cache.Cache[string, string] = nil
-	fileIDCache, err = lru.New[string, string](cfg.CacheSize)
-	if err != nil {
-		logger.Error("Failed to create LRU cache, using no-op cache",
-			zap.Error(err),
-			zap.Int("cache_size", cfg.CacheSize))
-		fileIDCache = cache.EmptyCache[string, string]{}
+	if cfg.CacheBackend == vtt.CacheBackendRedis {
+		logger.Info("Setting up redis cache", zap.String("addr", cfg.RedisAddr))
+		redisCache, err := cache.NewRedisCache(logger, cache.RedisConfig{
+			Addr:         cfg.RedisAddr,
+			Password:     cfg.RedisPassword,
+			DB:           cfg.RedisDB,
+			KeyPrefix:    cfg.RedisKeyPrefix,
+			TTL:          time.Duration(cfg.RedisTTL) * time.Second,
+			PoolSize:     cfg.RedisPoolSize,
+			DialTimeout:  time.Duration(cfg.RedisDialTimeoutMs) * time.Millisecond,
+			ReadTimeout:  time.Duration(cfg.RedisTimeoutMs) * time.Millisecond,
+			WriteTimeout: time.Duration(cfg.RedisTimeoutMs) * time.Millisecond,
+		})
+		if err != nil {
+			logger.Fatal("Failed to connect to redis cache", zap.Error(err))
+		}
+		defer redisCache.Close()
+		fileIDCache = redisCache
 	} else {
-		logger.Info("LRU cache created successfully")
+		logger.Info("Setting up file ID cache", zap.Int("size", cfg.CacheSize))
+		fileIDCache, err = lru.New[string, string](cfg.CacheSize)
+		if err != nil {
+			logger.Error("Failed to create LRU cache, using no-op cache",
+				zap.Error(err),
+				zap.Int("cache_size", cfg.CacheSize))
+			fileIDCache = cache.EmptyCache[string, string]{}
+		} else {
+			logger.Info("LRU cache created successfully")
+		}
+	}
+
+	sttClients, err := vtt.NewSTTClients(logger, cfg.ModelInstances)
+	if err != nil {
+		logger.Fatal("Failed to create STT clients", zap.Error(err))
+	}
+	var sttClient stt.STTClient = sttClients
+
+	var gates []scheduler.WorkerGate[string]
+	var availabilities []stt.WorkerAvailability
+
+	if cfg.HealthCheckEndpoint != "" {
+		logger.Info("Setting up model instance health checks",
+			zap.String("endpoint", cfg.HealthCheckEndpoint))
+		checker := health.NewChecker(logger,
+			health.Config{
+				Interval:         time.Duration(cfg.HealthCheckInterval) * time.Second,
+				Timeout:          time.Duration(cfg.HealthCheckTimeout) * time.Second,
+				FailureThreshold: cfg.HealthCheckFailureThreshold,
+				SuccessThreshold: cfg.HealthCheckSuccessThreshold,
+			},
+			sttClients.HealthProbe(cfg.HealthCheckEndpoint),
+			cfg.ModelInstanceURLs,
+		)
+		checker.Start(ctx)
+		defer checker.Stop()
+
+		gates = append(gates, checker)
+		availabilities = append(availabilities, checker)
+	}
+
+	if cfg.CircuitBreakerEnabled {
+		logger.Info("Setting up circuit breakers for model instances")
+		breakers := breaker.NewSet(logger,
+			breaker.Config{
+				Window:           time.Duration(cfg.CircuitBreakerWindow) * time.Second,
+				MinRequests:      cfg.CircuitBreakerMinRequests,
+				ErrorRate:        cfg.CircuitBreakerErrorRate,
+				SlowCallDuration: time.Duration(cfg.CircuitBreakerSlowCallDuration) * time.Second,
+				SlowCallRate:     cfg.CircuitBreakerSlowCallRate,
+				OpenTimeout:      time.Duration(cfg.CircuitBreakerOpenTimeout) * time.Second,
+				HalfOpenProbes:   cfg.CircuitBreakerHalfOpenProbes,
+			},
+			cfg.ModelInstanceURLs,
+		)
+
+		sttClient = stt.STTClientWithBreaker{Client: sttClient, Breakers: breakers}
+		gates = append(gates, breakers)
+		availabilities = append(availabilities, breakers)
+	}
+
+	if len(gates) > 0 {
+		sched.SetGate(scheduler.AllGates(gates...))
 	}
 
 	logger.Info("Initializing STT service",
 		zap.Int("worker_count", len(cfg.ModelInstanceURLs)))
-	sttService := stt.NewSTTServiceWithScheduler(
+	var sttService stt.STTService = stt.NewSTTServiceWithScheduler(
 		logger,
-		stt.STTClientDefault{Logger: logger},
+		sttClient,
 		sched,
 		cfg.ModelInstanceURLs,
+		stt.AllAvailable(availabilities...),
+		time.Duration(cfg.STTRequestTimeout)*time.Second,
+		stt.RetryPolicy{
+			MaxAttempts: cfg.STTMaxAttempts,
+			BaseDelay:   time.Duration(cfg.STTRetryBaseDelayMs) * time.Millisecond,
+			MaxDelay:    time.Duration(cfg.STTRetryMaxDelayMs) * time.Millisecond,
+		},
 	)
 
+	if cfg.ChunkDuration > 0 {
+		sttService = stt.NewSTTServiceChunked(logger,
+			sttService,
+			stt.FFmpegSplitter{FFmpegPath: cfg.FFmpegPath, FFprobePath: cfg.FFprobePath},
+			time.Duration(cfg.ChunkDuration)*time.Second,
+			time.Duration(cfg.ChunkOverlap)*time.Second,
+		)
+	}
+
+	catalog, err := i18n.Load(cfg.LocalesDir, cfg.DefaultLocale)
+	if err != nil {
+		logger.Fatal("Failed to load locales", zap.Error(err))
+	}
+
+	logger.Info("Setting up chat settings store",
+		zap.String("store", cfg.SettingsStore),
+		zap.String("path", cfg.SettingsPath))
+	defaultSettings := settings.Settings{
+		SubtitleFormat: cfg.SubtitleFormat,
+		AutoTranscribe: true,
+	}
+	var settingsStore settings.Store = settings.NewMemoryStore(defaultSettings)
+	if cfg.SettingsStore == vtt.SettingsStoreBolt {
+		settingsStore, err = settings.NewBoltStore(cfg.SettingsPath, defaultSettings)
+		if err != nil {
+			logger.Fatal("Failed to open chat settings store", zap.Error(err))
+		}
+	}
+	defer func() {
+		if err := settingsStore.Close(); err != nil {
+			logger.Error("Failed to close chat settings store", zap.Error(err))
+		}
+	}()
+
 	logger.Info("Creating update handler")
-	uh, err := vtt.NewVoiceToTextUpdateHandler(logger, sttService, fileIDCache)
+	vttHandler, err := vtt.NewVoiceToTextUpdateHandler(logger, sttService, fileIDCache,
+		catalog, settingsStore, cfg.SpeechLanguages,
+		time.Duration(cfg.TranscriptionTimeout)*time.Second,
+		cfg.TextDocumentLength)
 	if err != nil {
 		logger.Fatal("Failed to create update handler", zap.Error(err))
 	}
 
+	router := botwork.NewRouter(logger)
+	router.Use(botwork.Logging(logger))
+	if len(cfg.AllowedChatIDs) > 0 {
+		router.Use(botwork.Auth(botwork.AllowChats(cfg.AllowedChatIDs), nil))
+	}
+	if cfg.RateLimitPerMinute > 0 {
+		router.Use(botwork.RateLimit(cfg.RateLimitPerMinute, cfg.RateLimitBurst,
+			botwork.HandlerFunc(vttHandler.RateLimitedHandle)))
+	}
+	vtt.NewCommandHandler(logger, vttHandler).Register(router)
+	router.Message(botwork.HandlerFunc(vttHandler.MessageHandle))
+	router.CallbackQuery(botwork.HandlerFunc(vttHandler.CallbackHandle))
+
+	dedup, err := botwork.NewDeduplicator(logger, cfg.UpdateDedupWindow, cfg.UpdateDedupPath)
+	if err != nil {
+		logger.Fatal("Failed to create update deduplicator", zap.Error(err))
+	}
+	defer func() {
+		if err := dedup.Close(); err != nil {
+			logger.Error("Failed to close update deduplicator", zap.Error(err))
+		}
+	}()
+
 	// Start bot
 	switch cfg.Mode {
 	case "webhook":
@@ -88,17 +233,40 @@ func main() {
 		if err := botwork.RunOnWebHook(
 			ctx, logger, cfg.Name,
 			cfg.Token, cfg.ListenAddr,
-			uh, cfg.Debug,
+			router, cfg.Debug,
+			cfg.UpdateConcurrency,
+			time.Duration(cfg.ShutdownGracePeriod)*time.Second,
+			botwork.WebhookOptions{
+				PublicURL:          cfg.WebhookURL,
+				SecretToken:        cfg.WebhookSecretToken,
+				AllowedUpdates:     cfg.WebhookAllowedUpdates,
+				MaxConnections:     cfg.WebhookMaxConnections,
+				DropPendingUpdates: cfg.WebhookDropPendingUpdates,
+				DeleteOnShutdown:   cfg.WebhookDeleteOnShutdown,
+				TLSCertFile:        cfg.WebhookTLSCert,
+				TLSKeyFile:         cfg.WebhookTLSKey,
+				SelfSigned:         cfg.WebhookSelfSigned,
+			},
+			dedup,
 		); err != nil {
 			logger.Error("webhook stopped", zap.Error(err))
 		}
 
 	case "longpoll":
 		logger.Info("starting longpoll mode", zap.String("listen_addr", cfg.ListenAddr), zap.Int("timeout", cfg.Timeout))
+		offsets, err := botwork.NewOffsetTracker(logger, cfg.OffsetPath)
+		if err != nil {
+			logger.Fatal("Failed to create offset tracker", zap.Error(err))
+		}
 		if err := botwork.RunOnLongPolling(
 			ctx, logger, cfg.Name,
 			cfg.Token, cfg.ListenAddr,
-			uh, cfg.Timeout, cfg.Debug,
+			router, cfg.Timeout, cfg.Debug,
+			cfg.UpdateConcurrency,
+			time.Duration(cfg.ShutdownGracePeriod)*time.Second,
+			dedup,
+			offsets,
+			time.Duration(cfg.SkipUpdatesOlderThan)*time.Minute,
 		); err != nil {
 			logger.Error("longpoll stopped", zap.Error(err))
 		}
@@ -0,0 +1,89 @@
+package vtt
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errCanceledByUser is the cause of a transcription canceled with /cancel.
+var errCanceledByUser = errors.New("transcription canceled by user")
+
+// handlerStats are the counters shown by /stats since the start of the bot.
+type handlerStats struct {
+	started time.Time
+
+	messages    atomic.Int64 // media messages received
+	transcribed atomic.Int64
+	cacheHits   atomic.Int64
+	failed      atomic.Int64
+	canceled    atomic.Int64
+	audioMillis atomic.Int64 // total duration of the transcribed audio
+}
+
+func newHandlerStats() *handlerStats {
+	return &handlerStats{started: time.Now()}
+}
+
+func (s *handlerStats) addAudio(seconds float64) {
+	s.audioMillis.Add(int64(seconds * 1000))
+}
+
+// inFlight keeps the cancel funcs of the transcriptions in progress by chat.
+type inFlight struct {
+	mu    sync.Mutex
+	next  int
+	chats map[int64]map[int]context.CancelCauseFunc
+}
+
+func newInFlight() *inFlight {
+	return &inFlight{chats: make(map[int64]map[int]context.CancelCauseFunc)}
+}
+
+// add registers a transcription of the chat; remove must be called when it
+// is over.
+func (f *inFlight) add(chatID int64, cancel context.CancelCauseFunc) (remove func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.next++
+	id := f.next
+	if f.chats[chatID] == nil {
+		f.chats[chatID] = make(map[int]context.CancelCauseFunc)
+	}
+	f.chats[chatID][id] = cancel
+
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		delete(f.chats[chatID], id)
+		if len(f.chats[chatID]) == 0 {
+			delete(f.chats, chatID)
+		}
+	}
+}
+
+// cancel cancels all transcriptions of the chat and returns their number.
+func (f *inFlight) cancel(chatID int64) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, cancel := range f.chats[chatID] {
+		cancel(errCanceledByUser)
+	}
+	return len(f.chats[chatID])
+}
+
+func (f *inFlight) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n := 0
+	for _, chat := range f.chats {
+		n += len(chat)
+	}
+	return n
+}
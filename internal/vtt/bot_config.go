@@ -6,17 +6,140 @@ import (
 
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
+
+	"tg-bot-voice-to-text/internal/vtt/stt"
+	"tg-bot-voice-to-text/internal/vtt/subtitles"
 )
 
 type Config struct {
-	Token             string   `mapstructure:"token"`
-	Mode              string   `mapstructure:"mode"` // webhook | longpoll
-	Name              string   `mapstructure:"name"`
-	Debug             bool     `mapstructure:"debug"`
-	ListenAddr        string   `mapstructure:"listen_addr"`
-	CacheSize         int      `mapstructure:"cache_size"`
-	Timeout           int      `mapstructure:"timeout"` // for longpoll
-	ModelInstanceURLs []string `mapstructure:"model_instance_urls"`
+	Token             string                `mapstructure:"token"`
+	Mode              string                `mapstructure:"mode"` // webhook | longpoll
+	Name              string                `mapstructure:"name"`
+	Debug             bool                  `mapstructure:"debug"`
+	ListenAddr        string                `mapstructure:"listen_addr"`
+	CacheBackend      string                `mapstructure:"cache_backend"`       // lru | redis
+	CacheSize         int                   `mapstructure:"cache_size"`          // lru entries, an audio takes up to three: the result and the aliases of its file
+	Timeout           int                   `mapstructure:"timeout"`             // for longpoll
+	ModelInstanceURLs []string              `mapstructure:"model_instance_urls"` // default backend; after loading, worker IDs of all ModelInstances
+	ModelInstances    []ModelInstanceConfig `mapstructure:"model_instances"`
+
+	WebhookURL                string   `mapstructure:"webhook_url"` // public URL for setWebhook, empty to set the webhook by hand
+	WebhookSecretToken        string   `mapstructure:"webhook_secret_token"`
+	WebhookAllowedUpdates     []string `mapstructure:"webhook_allowed_updates"`
+	WebhookMaxConnections     int      `mapstructure:"webhook_max_connections"`
+	WebhookDropPendingUpdates bool     `mapstructure:"webhook_drop_pending_updates"`
+	WebhookDeleteOnShutdown   bool     `mapstructure:"webhook_delete_on_shutdown"`
+	WebhookTLSCert            string   `mapstructure:"webhook_tls_cert"` // with the key, TLS is served by the bot itself
+	WebhookTLSKey             string   `mapstructure:"webhook_tls_key"`
+	WebhookSelfSigned         bool     `mapstructure:"webhook_self_signed"` // upload the certificate in setWebhook, generate it if missing
+
+	UpdateConcurrency   int `mapstructure:"update_concurrency"`    // updates handled at once, as many more may wait
+	ShutdownGracePeriod int `mapstructure:"shutdown_grace_period"` // seconds for running handlers to finish on shutdown
+
+	AllowedChatIDs     []int64 `mapstructure:"allowed_chat_ids"`      // empty allows every chat
+	RateLimitPerMinute int     `mapstructure:"rate_limit_per_minute"` // updates per chat, 0 disables the limit
+	RateLimitBurst     int     `mapstructure:"rate_limit_burst"`
+
+	UpdateDedupWindow int    `mapstructure:"update_dedup_window"` // last update IDs remembered to skip redeliveries
+	UpdateDedupPath   string `mapstructure:"update_dedup_path"`   // file to keep them across restarts, empty keeps them in memory
+
+	OffsetPath           string `mapstructure:"offset_path"`             // longpoll, file with the last handled update ID
+	SkipUpdatesOlderThan int    `mapstructure:"skip_updates_older_than"` // minutes, longpoll skips older messages; 0 handles all
+
+	STTRequestTimeout    int `mapstructure:"stt_request_timeout"`   // seconds, one request to a model instance
+	TranscriptionTimeout int `mapstructure:"transcription_timeout"` // seconds, whole message handling
+
+	STTMaxAttempts      int `mapstructure:"stt_max_attempts"`
+	STTRetryBaseDelayMs int `mapstructure:"stt_retry_base_delay_ms"`
+	STTRetryMaxDelayMs  int `mapstructure:"stt_retry_max_delay_ms"`
+
+	HealthCheckEndpoint         string `mapstructure:"health_check_endpoint"` // empty disables health checks
+	HealthCheckInterval         int    `mapstructure:"health_check_interval"` // seconds
+	HealthCheckTimeout          int    `mapstructure:"health_check_timeout"`  // seconds
+	HealthCheckFailureThreshold int    `mapstructure:"health_check_failure_threshold"`
+	HealthCheckSuccessThreshold int    `mapstructure:"health_check_success_threshold"`
+
+	CircuitBreakerEnabled          bool    `mapstructure:"circuit_breaker_enabled"`
+	CircuitBreakerWindow           int     `mapstructure:"circuit_breaker_window"` // seconds
+	CircuitBreakerMinRequests      int     `mapstructure:"circuit_breaker_min_requests"`
+	CircuitBreakerErrorRate        float64 `mapstructure:"circuit_breaker_error_rate"`
+	CircuitBreakerSlowCallDuration int     `mapstructure:"circuit_breaker_slow_call_duration"` // seconds, 0 disables
+	CircuitBreakerSlowCallRate     float64 `mapstructure:"circuit_breaker_slow_call_rate"`     // 0 disables
+	CircuitBreakerOpenTimeout      int     `mapstructure:"circuit_breaker_open_timeout"`       // seconds
+	CircuitBreakerHalfOpenProbes   int     `mapstructure:"circuit_breaker_half_open_probes"`
+
+	ChunkDuration int    `mapstructure:"chunk_duration"` // seconds, 0 disables splitting of long audio
+	ChunkOverlap  int    `mapstructure:"chunk_overlap"`  // seconds
+	FFmpegPath    string `mapstructure:"ffmpeg_path"`
+	FFprobePath   string `mapstructure:"ffprobe_path"`
+
+	SubtitleFormat string `mapstructure:"subtitle_format"` // srt | vtt | json, default of chats for the file sent after a transcription; empty disables
+
+	TextDocumentLength int `mapstructure:"text_document_length"` // characters, longer transcriptions are sent as a .txt file
+
+	LocalesDir    string `mapstructure:"locales_dir"`    // <lang>.yml files with the bot replies
+	DefaultLocale string `mapstructure:"default_locale"` // for users whose Telegram language has no locale
+
+	SpeechLanguages []string `mapstructure:"speech_languages"` // language hints for the backends offered in /settings and /lang, e.g. ru
+
+	SettingsStore string `mapstructure:"settings_store"` // memory | bolt
+	SettingsPath  string `mapstructure:"settings_path"`  // bolt database file with the chat settings
+
+	RedisAddr          string `mapstructure:"redis_addr"` // host:port of the redis cache backend
+	RedisPassword      string `mapstructure:"redis_password"`
+	RedisDB            int    `mapstructure:"redis_db"`
+	RedisKeyPrefix     string `mapstructure:"redis_key_prefix"`
+	RedisTTL           int    `mapstructure:"redis_ttl"` // seconds a result is kept
+	RedisPoolSize      int    `mapstructure:"redis_pool_size"`
+	RedisDialTimeoutMs int    `mapstructure:"redis_dial_timeout_ms"` // also the wait for a free connection
+	RedisTimeoutMs     int    `mapstructure:"redis_timeout_ms"`      // read and write of one command
+}
+
+const (
+	CacheBackendLRU   = "lru"
+	CacheBackendRedis = "redis"
+)
+
+const (
+	SettingsStoreMemory = "memory"
+	SettingsStoreBolt   = "bolt"
+)
+
+const (
+	BackendDefault = "default"
+	BackendOpenAI  = "openai"
+	BackendCommand = "command"
+)
+
+type ModelInstanceConfig struct {
+	URL     string `mapstructure:"url"`     // worker ID, any unique name for the command backend
+	Backend string `mapstructure:"backend"` // default | openai | command
+
+	// openai backend
+	Model          string   `mapstructure:"model"`
+	Language       string   `mapstructure:"language"`
+	Prompt         string   `mapstructure:"prompt"`
+	Temperature    *float64 `mapstructure:"temperature"`     // unset leaves it to the server
+	ResponseFormat string   `mapstructure:"response_format"` // json | verbose_json | text
+	APIKey         string   `mapstructure:"api_key"`
+
+	// command backend
+	Command        []string `mapstructure:"command"`
+	OutputFormat   string   `mapstructure:"output_format"`   // text | json
+	ProcessTimeout int      `mapstructure:"process_timeout"` // seconds
+	Concurrency    int      `mapstructure:"concurrency"`     // local slots, each one is a scheduler worker
+}
+
+func (instance ModelInstanceConfig) WorkerIDs() []string {
+	if instance.Backend != BackendCommand || instance.Concurrency <= 1 {
+		return []string{instance.URL}
+	}
+
+	ids := make([]string, instance.Concurrency)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("%s#%d", instance.URL, i)
+	}
+	return ids
 }
 
 func LoadBotConfig(logger *zap.Logger, path string) (*Config, error) {
@@ -32,9 +155,65 @@ func LoadBotConfig(logger *zap.Logger, path string) (*Config, error) {
 	_ = v.BindEnv("name")
 	_ = v.BindEnv("debug")
 	_ = v.BindEnv("listen_addr")
+	_ = v.BindEnv("cache_backend")
 	_ = v.BindEnv("cache_size")
 	_ = v.BindEnv("timeout")
+	_ = v.BindEnv("webhook_url")
+	_ = v.BindEnv("webhook_secret_token")
+	_ = v.BindEnv("webhook_allowed_updates")
+	_ = v.BindEnv("webhook_max_connections")
+	_ = v.BindEnv("webhook_drop_pending_updates")
+	_ = v.BindEnv("webhook_delete_on_shutdown")
+	_ = v.BindEnv("webhook_tls_cert")
+	_ = v.BindEnv("webhook_tls_key")
+	_ = v.BindEnv("webhook_self_signed")
+	_ = v.BindEnv("update_concurrency")
+	_ = v.BindEnv("shutdown_grace_period")
+	_ = v.BindEnv("allowed_chat_ids")
+	_ = v.BindEnv("rate_limit_per_minute")
+	_ = v.BindEnv("rate_limit_burst")
+	_ = v.BindEnv("update_dedup_window")
+	_ = v.BindEnv("update_dedup_path")
+	_ = v.BindEnv("offset_path")
+	_ = v.BindEnv("skip_updates_older_than")
 	_ = v.BindEnv("model_instance_urls")
+	_ = v.BindEnv("stt_request_timeout")
+	_ = v.BindEnv("transcription_timeout")
+	_ = v.BindEnv("stt_max_attempts")
+	_ = v.BindEnv("stt_retry_base_delay_ms")
+	_ = v.BindEnv("stt_retry_max_delay_ms")
+	_ = v.BindEnv("health_check_endpoint")
+	_ = v.BindEnv("health_check_interval")
+	_ = v.BindEnv("health_check_timeout")
+	_ = v.BindEnv("health_check_failure_threshold")
+	_ = v.BindEnv("health_check_success_threshold")
+	_ = v.BindEnv("circuit_breaker_enabled")
+	_ = v.BindEnv("circuit_breaker_window")
+	_ = v.BindEnv("circuit_breaker_min_requests")
+	_ = v.BindEnv("circuit_breaker_error_rate")
+	_ = v.BindEnv("circuit_breaker_slow_call_duration")
+	_ = v.BindEnv("circuit_breaker_slow_call_rate")
+	_ = v.BindEnv("circuit_breaker_open_timeout")
+	_ = v.BindEnv("circuit_breaker_half_open_probes")
+	_ = v.BindEnv("chunk_duration")
+	_ = v.BindEnv("chunk_overlap")
+	_ = v.BindEnv("ffmpeg_path")
+	_ = v.BindEnv("ffprobe_path")
+	_ = v.BindEnv("subtitle_format")
+	_ = v.BindEnv("text_document_length")
+	_ = v.BindEnv("locales_dir")
+	_ = v.BindEnv("default_locale")
+	_ = v.BindEnv("speech_languages")
+	_ = v.BindEnv("settings_store")
+	_ = v.BindEnv("settings_path")
+	_ = v.BindEnv("redis_addr")
+	_ = v.BindEnv("redis_password")
+	_ = v.BindEnv("redis_db")
+	_ = v.BindEnv("redis_key_prefix")
+	_ = v.BindEnv("redis_ttl")
+	_ = v.BindEnv("redis_pool_size")
+	_ = v.BindEnv("redis_dial_timeout_ms")
+	_ = v.BindEnv("redis_timeout_ms")
 
 	if err := v.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
@@ -53,6 +232,43 @@ func LoadBotConfig(logger *zap.Logger, path string) (*Config, error) {
 		return nil, fmt.Errorf("bot token is required")
 	}
 
+	if err := cfg.normalizeModelInstances(); err != nil {
+		return nil, err
+	}
+	if (cfg.WebhookTLSCert == "") != (cfg.WebhookTLSKey == "") {
+		return nil, fmt.Errorf("webhook TLS needs both webhook_tls_cert and webhook_tls_key")
+	}
+	if cfg.WebhookSelfSigned && (cfg.WebhookTLSCert == "" || cfg.WebhookURL == "") {
+		return nil, fmt.Errorf("self-signed webhook needs webhook_url, webhook_tls_cert and webhook_tls_key")
+	}
+	if !validSecretToken(cfg.WebhookSecretToken) {
+		return nil, fmt.Errorf("webhook secret token must be up to 256 characters A-Z, a-z, 0-9, _ or -")
+	}
+	if cfg.SubtitleFormat != "" && !subtitles.IsFormat(cfg.SubtitleFormat) {
+		return nil, fmt.Errorf("unknown subtitle format %q", cfg.SubtitleFormat)
+	}
+	for i, lang := range cfg.SpeechLanguages {
+		lang = strings.ToLower(strings.TrimSpace(lang))
+		if lang == "" || lang == "auto" || strings.Contains(lang, ":") {
+			return nil, fmt.Errorf("invalid speech language %q", cfg.SpeechLanguages[i])
+		}
+		cfg.SpeechLanguages[i] = lang
+	}
+	switch cfg.CacheBackend {
+	case "":
+		cfg.CacheBackend = CacheBackendLRU
+	case CacheBackendLRU, CacheBackendRedis:
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", cfg.CacheBackend)
+	}
+	switch cfg.SettingsStore {
+	case "":
+		cfg.SettingsStore = SettingsStoreMemory
+	case SettingsStoreMemory, SettingsStoreBolt:
+	default:
+		return nil, fmt.Errorf("unknown settings store %q", cfg.SettingsStore)
+	}
+
 	if cfg.Mode == "" {
 		cfg.Mode = "longpoll"
 	}
@@ -62,9 +278,105 @@ func LoadBotConfig(logger *zap.Logger, path string) (*Config, error) {
 	if cfg.Timeout <= 0 {
 		cfg.Timeout = 60
 	}
+	if cfg.UpdateConcurrency <= 0 {
+		cfg.UpdateConcurrency = 8
+	}
+	if cfg.ShutdownGracePeriod <= 0 {
+		cfg.ShutdownGracePeriod = 30
+	}
+	if cfg.RateLimitBurst <= 0 {
+		cfg.RateLimitBurst = 5
+	}
+	if cfg.UpdateDedupWindow <= 0 {
+		cfg.UpdateDedupWindow = 10000
+	}
 	if cfg.CacheSize <= 0 {
 		cfg.CacheSize = 100
 	}
+	if cfg.STTRequestTimeout <= 0 {
+		cfg.STTRequestTimeout = 120
+	}
+	if cfg.TranscriptionTimeout <= 0 {
+		cfg.TranscriptionTimeout = 300
+	}
+	if cfg.STTMaxAttempts <= 0 {
+		cfg.STTMaxAttempts = 3
+	}
+	if cfg.STTRetryBaseDelayMs <= 0 {
+		cfg.STTRetryBaseDelayMs = 500
+	}
+	if cfg.STTRetryMaxDelayMs <= 0 {
+		cfg.STTRetryMaxDelayMs = 5000
+	}
+	if cfg.HealthCheckInterval <= 0 {
+		cfg.HealthCheckInterval = 10
+	}
+	if cfg.HealthCheckTimeout <= 0 {
+		cfg.HealthCheckTimeout = 5
+	}
+	if cfg.HealthCheckFailureThreshold <= 0 {
+		cfg.HealthCheckFailureThreshold = 3
+	}
+	if cfg.HealthCheckSuccessThreshold <= 0 {
+		cfg.HealthCheckSuccessThreshold = 1
+	}
+	if cfg.CircuitBreakerWindow <= 0 {
+		cfg.CircuitBreakerWindow = 60
+	}
+	if cfg.CircuitBreakerMinRequests <= 0 {
+		cfg.CircuitBreakerMinRequests = 5
+	}
+	if cfg.CircuitBreakerErrorRate <= 0 {
+		cfg.CircuitBreakerErrorRate = 0.5
+	}
+	if cfg.CircuitBreakerOpenTimeout <= 0 {
+		cfg.CircuitBreakerOpenTimeout = 30
+	}
+	if cfg.CircuitBreakerHalfOpenProbes <= 0 {
+		cfg.CircuitBreakerHalfOpenProbes = 1
+	}
+	if cfg.ChunkOverlap < 0 {
+		cfg.ChunkOverlap = 0
+	}
+	if cfg.FFmpegPath == "" {
+		cfg.FFmpegPath = "ffmpeg"
+	}
+	if cfg.FFprobePath == "" {
+		cfg.FFprobePath = "ffprobe"
+	}
+	if cfg.TextDocumentLength <= 0 {
+		cfg.TextDocumentLength = 16384
+	}
+	if cfg.LocalesDir == "" {
+		cfg.LocalesDir = "./configs/locales"
+	}
+	if cfg.DefaultLocale == "" {
+		cfg.DefaultLocale = "ru"
+	}
+	if len(cfg.SpeechLanguages) == 0 {
+		cfg.SpeechLanguages = []string{"ru", "en"}
+	}
+	if cfg.SettingsPath == "" {
+		cfg.SettingsPath = "./data/settings.db"
+	}
+	if cfg.RedisAddr == "" {
+		cfg.RedisAddr = "localhost:6379"
+	}
+	if cfg.RedisKeyPrefix == "" {
+		cfg.RedisKeyPrefix = "vtt:"
+	}
+	if cfg.RedisTTL <= 0 {
+		cfg.RedisTTL = 7 * 24 * 60 * 60
+	}
+	if cfg.RedisPoolSize <= 0 {
+		cfg.RedisPoolSize = 10
+	}
+	if cfg.RedisDialTimeoutMs <= 0 {
+		cfg.RedisDialTimeoutMs = 1000
+	}
+	if cfg.RedisTimeoutMs <= 0 {
+		cfg.RedisTimeoutMs = 500
+	}
 
 	logger.Info("loaded bot configuration",
 		zap.String("mode", cfg.Mode),
@@ -72,9 +384,98 @@ func LoadBotConfig(logger *zap.Logger, path string) (*Config, error) {
 		zap.String("listen_addr", cfg.ListenAddr),
 		zap.Bool("debug", cfg.Debug),
 		zap.Int("timeout", cfg.Timeout),
+		zap.String("webhook_url", cfg.WebhookURL),
+		zap.Bool("webhook_secret_token_set", cfg.WebhookSecretToken != ""),
+		zap.Strings("webhook_allowed_updates", cfg.WebhookAllowedUpdates),
+		zap.String("webhook_tls_cert", cfg.WebhookTLSCert),
+		zap.Bool("webhook_self_signed", cfg.WebhookSelfSigned),
+		zap.Int("update_concurrency", cfg.UpdateConcurrency),
+		zap.Int("shutdown_grace_period", cfg.ShutdownGracePeriod),
+		zap.Int64s("allowed_chat_ids", cfg.AllowedChatIDs),
+		zap.Int("rate_limit_per_minute", cfg.RateLimitPerMinute),
+		zap.Int("rate_limit_burst", cfg.RateLimitBurst),
+		zap.Int("update_dedup_window", cfg.UpdateDedupWindow),
+		zap.String("update_dedup_path", cfg.UpdateDedupPath),
+		zap.String("offset_path", cfg.OffsetPath),
+		zap.Int("skip_updates_older_than", cfg.SkipUpdatesOlderThan),
+		zap.String("cache_backend", cfg.CacheBackend),
 		zap.Int("cache_size", cfg.CacheSize),
 		zap.Strings("model_instance_urls", cfg.ModelInstanceURLs),
+		zap.Int("stt_request_timeout", cfg.STTRequestTimeout),
+		zap.Int("transcription_timeout", cfg.TranscriptionTimeout),
+		zap.Int("stt_max_attempts", cfg.STTMaxAttempts),
+		zap.Int("stt_retry_base_delay_ms", cfg.STTRetryBaseDelayMs),
+		zap.Int("stt_retry_max_delay_ms", cfg.STTRetryMaxDelayMs),
+		zap.String("health_check_endpoint", cfg.HealthCheckEndpoint),
+		zap.Int("health_check_interval", cfg.HealthCheckInterval),
+		zap.Bool("circuit_breaker_enabled", cfg.CircuitBreakerEnabled),
+		zap.Int("chunk_duration", cfg.ChunkDuration),
+		zap.Int("chunk_overlap", cfg.ChunkOverlap),
+		zap.String("subtitle_format", cfg.SubtitleFormat),
+		zap.Int("text_document_length", cfg.TextDocumentLength),
+		zap.String("locales_dir", cfg.LocalesDir),
+		zap.String("default_locale", cfg.DefaultLocale),
+		zap.Strings("speech_languages", cfg.SpeechLanguages),
+		zap.String("settings_store", cfg.SettingsStore),
+		zap.String("settings_path", cfg.SettingsPath),
+		zap.String("redis_addr", cfg.RedisAddr),
+		zap.Int("redis_db", cfg.RedisDB),
+		zap.String("redis_key_prefix", cfg.RedisKeyPrefix),
+		zap.Int("redis_ttl", cfg.RedisTTL),
+		zap.Int("redis_pool_size", cfg.RedisPoolSize),
 	)
 
 	return &cfg, nil
 }
+
+func (cfg *Config) normalizeModelInstances() error {
+	for _, url := range cfg.ModelInstanceURLs {
+		cfg.ModelInstances = append(cfg.ModelInstances, ModelInstanceConfig{URL: url})
+	}
+
+	urls := make([]string, 0, len(cfg.ModelInstances))
+	seen := make(map[string]bool, len(cfg.ModelInstances))
+	for i := range cfg.ModelInstances {
+		instance := &cfg.ModelInstances[i]
+		if instance.URL == "" {
+			return fmt.Errorf("model instance #%d: url is required", i)
+		}
+		if seen[instance.URL] {
+			return fmt.Errorf("model instance %s is configured twice", instance.URL)
+		}
+		seen[instance.URL] = true
+
+		switch instance.Backend {
+		case "":
+			instance.Backend = BackendDefault
+		case BackendDefault:
+		case BackendOpenAI:
+			if !stt.IsOpenAIResponseFormat(instance.ResponseFormat) {
+				return fmt.Errorf("model instance %s: response format %q is not supported, use json, verbose_json or text", instance.URL, instance.ResponseFormat)
+			}
+		case BackendCommand:
+			if len(instance.Command) == 0 {
+				return fmt.Errorf("model instance %s: command is required for the command backend", instance.URL)
+			}
+		default:
+			return fmt.Errorf("model instance %s: unknown backend %q", instance.URL, instance.Backend)
+		}
+
+		urls = append(urls, instance.WorkerIDs()...)
+	}
+
+	cfg.ModelInstanceURLs = urls
+	return nil
+}
+
+func validSecretToken(token string) bool {
+	if len(token) > 256 {
+		return false
+	}
+	for _, r := range token {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
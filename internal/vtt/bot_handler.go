@@ -1,17 +1,23 @@
 package vtt
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"time"
 
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 
+	"tg-bot-voice-to-text/internal/vtt/i18n"
+	"tg-bot-voice-to-text/internal/vtt/settings"
 	"tg-bot-voice-to-text/internal/vtt/stt"
+	"tg-bot-voice-to-text/internal/vtt/subtitles"
 	"tg-bot-voice-to-text/pkg/cache"
 	"tg-bot-voice-to-text/pkg/utils"
 )
@@ -24,68 +30,112 @@ const (
 )
 
 type SpeechToTextUpdateHandler struct {
-	logger             *zap.Logger
-	stts               stt.STTService
-	processedFileCache cache.Cache[string, string]
+	logger          *zap.Logger
+	stts            stt.STTService
+	results         transcriptionCache
+	catalog         *i18n.Catalog
+	settings        settings.Store
+	speechLanguages []string // hints a chat can choose, see settings.Settings.SpeechLanguage
+
+	transcriptionTimeout time.Duration
+	textDocumentLength   int // longer texts are sent as a .txt document instead of messages
+
+	stats    *handlerStats
+	inFlight *inFlight
 }
 
-func NewVoiceToTextUpdateHandler(logger *zap.Logger, stts stt.STTService, cache cache.Cache[string, string]) (*SpeechToTextUpdateHandler, error) {
+func NewVoiceToTextUpdateHandler(logger *zap.Logger, stts stt.STTService, cache cache.Cache[string, string], catalog *i18n.Catalog, store settings.Store, speechLanguages []string, transcriptionTimeout time.Duration, textDocumentLength int) (*SpeechToTextUpdateHandler, error) {
 	logger = logger.Named("vtt-handler")
 
 	if err := os.Mkdir("./downloads", 0755); !errors.Is(err, os.ErrExist) && err != nil {
 		logger.Error("Failed to create downloads directory", zap.Error(err))
-		return nil, fmt.Errorf("error in create directory 'downloads': %v", err)
+		return nil, fmt.Errorf("error in create directory 'downloads': %w", err)
 	}
 
-	logger.Info("Handler initialized", zap.String("downloads_dir", "./downloads"))
+	logger.Info("Handler initialized",
+		zap.String("downloads_dir", "./downloads"),
+		zap.Strings("languages", catalog.Languages()),
+		zap.Strings("speech_languages", speechLanguages),
+		zap.Duration("transcription_timeout", transcriptionTimeout),
+		zap.Int("text_document_length", textDocumentLength))
 	return &SpeechToTextUpdateHandler{
-		logger:             logger,
-		stts:               stts,
-		processedFileCache: cache,
+		logger:               logger,
+		stts:                 stts,
+		results:              newTranscriptionCache(cache),
+		catalog:              catalog,
+		settings:             store,
+		speechLanguages:      speechLanguages,
+		transcriptionTimeout: transcriptionTimeout,
+		textDocumentLength:   textDocumentLength,
+		stats:                newHandlerStats(),
+		inFlight:             newInFlight(),
 	}, nil
 }
 
-func (v *SpeechToTextUpdateHandler) UpdateHandle(bot *tgbotapi.BotAPI, update *tgbotapi.Update) error {
-	if update.Message == nil {
+// MessageHandle transcribes the audio of a message.
+func (v *SpeechToTextUpdateHandler) MessageHandle(ctx context.Context, bot *tgbotapi.BotAPI, update *tgbotapi.Update) error {
+	message := update.Message
+	chat := v.chatSettings(message.Chat.ID, message.From)
+
+	if _, _, state := v.chooseReactionOnMessage(message, chat.Language); state != skipMessage && !message.Chat.IsPrivate() && !chat.AutoTranscribe {
+		v.logger.Info("Message skipped (auto transcription is off in the chat)",
+			zap.Int64("chat_id", message.Chat.ID),
+			zap.Int("message_id", message.MessageID))
 		return nil
 	}
 
+	return v.transcribeMessage(ctx, bot, message, chat)
+}
+
+// transcribeMessage replies to a message with the transcription of its audio,
+// using the language and output settings of chat.
+func (v *SpeechToTextUpdateHandler) transcribeMessage(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, chat settings.Settings) error {
+	if v.transcriptionTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, v.transcriptionTimeout)
+		defer cancel()
+	}
+
 	log := v.logger.With(
-		zap.Int64("chat_id", update.Message.Chat.ID),
-		zap.Int("message_id", update.Message.MessageID),
-		zap.String("user", update.Message.From.UserName),
+		zap.Int64("chat_id", message.Chat.ID),
+		zap.Int("message_id", message.MessageID),
+		zap.String("user", message.From.UserName),
 	)
 	log.Info("Processing new message")
 
-	fileID, msgText, state := v.chooseReactionOnMessage(update.Message)
-	log = log.With(zap.String("file_id", fileID), zap.Int("media_type", state))
+	lang := chat.Language
+	file, msgText, state := v.chooseReactionOnMessage(message, lang)
+	log = log.With(zap.String("file_id", file.ID), zap.String("file_unique_id", file.UniqueID), zap.Int("media_type", state),
+		zap.String("locale", lang), zap.String("speech_language", chat.SpeechLanguage))
 
-	sentMsg, err := v.ReactionOnMessage(bot, update.Message, fileID, msgText, state)
+	sentMsg, err := v.ReactionOnMessage(bot, message, file.ID, msgText, state)
 	if err != nil {
 		log.Error("Reaction on message failed", zap.Error(err))
-		return fmt.Errorf("error in reaction on message: %v", err)
+		return fmt.Errorf("error in reaction on message: %w", err)
 	}
 	if sentMsg == nil { // skip message
 		log.Info("Message skipped (not media)")
 		return nil
 	}
+	v.stats.messages.Add(1)
 
-	cacheHit, err := v.cacheHitCheck(bot, update.Message, sentMsg, fileID)
-	if err != nil {
-		log.Error("Cache check failed", zap.Error(err))
-		return fmt.Errorf("error in cache hit check: %v", err)
-	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	defer v.inFlight.add(message.Chat.ID, cancel)()
+
+	cached, cacheHit := v.results.lookup(file, chat.SpeechLanguage)
 	if cacheHit {
-		log.Info("Cache hit, returning cached result")
-		return nil
+		log.Info("Cache hit by file ID, returning cached result")
+		return v.showCached(bot, message, sentMsg, cached, chat)
 	}
 
-	filepath, err := v.downloadFile(bot, update.Message, sentMsg, fileID)
+	filepath, err := v.downloadFile(ctx, bot, message, sentMsg, file.ID, lang)
 	if err != nil {
 		log.Error("File download failed", zap.Error(err))
-		return fmt.Errorf("error in get file for transcription: %v", err)
+		return fmt.Errorf("error in get file for transcription: %w", err)
 	}
 	if filepath == "" {
+		v.stats.failed.Add(1)
 		return nil
 	}
 	defer func() {
@@ -98,47 +148,75 @@ func (v *SpeechToTextUpdateHandler) UpdateHandle(bot *tgbotapi.BotAPI, update *t
 		}
 	}()
 
-	log = log.With(zap.String("file_path", filepath))
+	hash, err := utils.FileSHA256(filepath)
+	if err != nil {
+		log.Error("File hashing failed", zap.Error(err))
+		return fmt.Errorf("error in hash downloaded file: %w", err)
+	}
+	v.results.link(file, hash)
+
+	log = log.With(zap.String("file_path", filepath), zap.String("sha256", hash))
 	log.Info("File downloaded successfully")
 
-	transcription, err := v.transcription(bot, update.Message, sentMsg, filepath)
+	result, cacheHit, err := v.results.resolve(ctx, hash, chat.SpeechLanguage, func() (*stt.Transcription, error) {
+		return v.transcription(ctx, bot, message, sentMsg, filepath, chat)
+	})
+	if errors.Is(err, errWaitingForAudio) {
+		log.Error("Waiting for the same audio failed", zap.Error(err))
+		return v.transcriptionFailed(ctx, bot, message, sentMsg, lang, err)
+	}
 	if err != nil {
 		log.Error("Transcription failed", zap.Error(err))
-		return fmt.Errorf("error in transcription: %v", err)
+		return fmt.Errorf("error in transcription: %w", err)
 	}
-	if transcription == "" {
+	if result == nil {
 		log.Info("Empty transcription result")
 		return nil
 	}
+	if cacheHit {
+		log.Info("Cache hit by content, returning cached result")
+		return v.showCached(bot, message, sentMsg, *result, chat)
+	}
 
-	if err := utils.EditMessage(bot, update.Message.Chat.ID, sentMsg.MessageID, transcription); err != nil {
+	transcription := v.displayText(*result, chat)
+	if err := v.showResult(bot, message.Chat.ID, sentMsg.MessageID, *result, chat); err != nil {
 		log.Error("Failed to edit message",
-			zap.String("transcription", transcription),
+			zap.String("transcription", utils.Ellipsis(transcription, 50)),
 			zap.Error(err))
-		return fmt.Errorf("error in edit message: [text: %s] %v", transcription, err)
+		return fmt.Errorf("error in edit message: [text: %s] %w", utils.Ellipsis(transcription, 50), err)
 	}
 
-	v.processedFileCache.Add(fileID, transcription)
+	v.stats.transcribed.Add(1)
+	v.stats.addAudio(result.Duration)
+
+	if chat.SubtitleFormat != "" && len(result.Segments) > 0 {
+		if err := v.sendSubtitles(bot, message, *result, chat.SubtitleFormat); err != nil {
+			log.Warn("Failed to send subtitles", zap.Error(err))
+		}
+	}
 	log.Info("Transcription completed",
-		zap.String("transcription", utils.Ellipsis(transcription, 50)))
+		zap.String("transcription", utils.Ellipsis(transcription, 50)),
+		zap.String("language", result.Language),
+		zap.Float64("duration", result.Duration),
+		zap.Int("segments", len(result.Segments)))
 
 	return nil
 }
 
-func (v SpeechToTextUpdateHandler) chooseReactionOnMessage(message *tgbotapi.Message) (string, string, int) {
+func (v SpeechToTextUpdateHandler) chooseReactionOnMessage(message *tgbotapi.Message, lang string) (mediaFile, string, int) {
 	switch {
 
 	case message.Audio != nil:
-		return message.Audio.FileID, "Получено аудио, обрабатываю...", audio
+		return mediaFile{message.Audio.FileID, message.Audio.FileUniqueID}, v.catalog.Text(lang, "received_audio"), audio
 
 	case message.Voice != nil:
-		return message.Voice.FileID, "Получено голосовое сообщение, обрабатываю...", voice
+		return mediaFile{message.Voice.FileID, message.Voice.FileUniqueID}, v.catalog.Text(lang, "received_voice"), voice
 
 	case message.VideoNote != nil:
-		return message.VideoNote.FileID, "Получено видео сообщение, обрабатываю...", videoNote
+		return mediaFile{message.VideoNote.FileID, message.VideoNote.FileUniqueID}, v.catalog.Text(lang, "received_video_note"), videoNote
 
 	default:
-		return "", "Отправте голосовое сообщение!", skipMessage
+		return mediaFile{}, v.catalog.Text(lang, "not_media"), skipMessage
 	}
 }
 
@@ -147,7 +225,7 @@ func (v SpeechToTextUpdateHandler) ReactionOnMessage(bot *tgbotapi.BotAPI, messa
 	if state == skipMessage {
 		if message.Chat.Type == "private" {
 			if err := utils.SendTextReply(bot, message.Chat.ID, message.MessageID, msgText); err != nil {
-				return nil, fmt.Errorf("error in send text: [text: %s] %v", msgText, err)
+				return nil, fmt.Errorf("error in send text: [text: %s] %w", msgText, err)
 			}
 		}
 
@@ -159,41 +237,36 @@ func (v SpeechToTextUpdateHandler) ReactionOnMessage(bot *tgbotapi.BotAPI, messa
 	acceptedMsg.ReplyToMessageID = message.MessageID
 	sentMsg, err := bot.Send(acceptedMsg)
 	if err != nil {
-		return nil, fmt.Errorf("error in sending accepted message: %v", err)
+		return nil, fmt.Errorf("error in sending accepted message: %w", err)
 	}
 
 	return &sentMsg, nil
 }
 
-func (v SpeechToTextUpdateHandler) cacheHitCheck(bot *tgbotapi.BotAPI, message, sentMsg *tgbotapi.Message, fileID string) (bool, error) {
-	// check cache
-	if text, exist := v.processedFileCache.Get(fileID); exist {
-		if err := utils.EditMessage(bot, message.Chat.ID, sentMsg.MessageID, text); err != nil {
-			return false, fmt.Errorf("error in send message: [text: %s] %v", text, err)
-		}
-
-		return true, nil // cache hit
+// showCached puts a cached result into the placeholder message.
+func (v SpeechToTextUpdateHandler) showCached(bot *tgbotapi.BotAPI, message, sentMsg *tgbotapi.Message, result stt.Transcription, chat settings.Settings) error {
+	v.stats.cacheHits.Add(1)
+	if err := v.showResult(bot, message.Chat.ID, sentMsg.MessageID, result, chat); err != nil {
+		return fmt.Errorf("error in send message: [text: %s] %w", utils.Ellipsis(v.displayText(result, chat), 50), err)
 	}
-	// cache miss
-
-	return false, nil
+	return nil
 }
 
-func (v SpeechToTextUpdateHandler) downloadFile(bot *tgbotapi.BotAPI, message, sentMsg *tgbotapi.Message, fileID string) (string, error) {
+func (v SpeechToTextUpdateHandler) downloadFile(ctx context.Context, bot *tgbotapi.BotAPI, message, sentMsg *tgbotapi.Message, fileID, lang string) (string, error) {
 	fileURL, err := bot.GetFileDirectURL(fileID)
 	if err != nil {
 		v.logger.Error("error in get file direct url", zap.String("file id", fileID), zap.Error(err))
-		if err := utils.EditMessage(bot, message.Chat.ID, message.MessageID, "Ошибка получения файла"); err != nil {
-			return "", fmt.Errorf("error in edit message: %v", err)
+		if err := utils.EditMessage(bot, message.Chat.ID, message.MessageID, v.catalog.Text(lang, "file_url_error")); err != nil {
+			return "", fmt.Errorf("error in edit message: %w", err)
 		}
 		return "", nil
 	}
 
-	filePath, err := utils.DownloadFile(v.logger, fileURL, fmt.Sprintf("tmp_%s", uuid.New()))
+	filePath, err := utils.DownloadFile(ctx, v.logger, fileURL, fmt.Sprintf("tmp_%s", uuid.New()))
 	if err != nil {
 		v.logger.Error("error in download file", zap.String("file url", fileURL), zap.Error(err))
-		if err := utils.EditMessage(bot, message.Chat.ID, sentMsg.MessageID, "Ошибка скачивания файла"); err != nil {
-			return "", fmt.Errorf("error in edit message: %v", err)
+		if err := utils.EditMessage(bot, message.Chat.ID, sentMsg.MessageID, v.catalog.Text(lang, "download_error")); err != nil {
+			return "", fmt.Errorf("error in edit message: %w", err)
 		}
 		return "", nil
 	}
@@ -201,25 +274,137 @@ func (v SpeechToTextUpdateHandler) downloadFile(bot *tgbotapi.BotAPI, message, s
 	absFilepath, err := filepath.Abs(filePath)
 	if err != nil {
 		_ = os.Remove(filePath)
-		return "", fmt.Errorf("error in transform path to abs path: %v", err)
+		return "", fmt.Errorf("error in transform path to abs path: %w", err)
 	}
 
 	return absFilepath, nil
 }
 
-func (v SpeechToTextUpdateHandler) transcription(bot *tgbotapi.BotAPI, message, sentMsg *tgbotapi.Message, filepath string) (string, error) {
-	transcription, err := v.stts.TransformSpeechToText(filepath)
+func (v SpeechToTextUpdateHandler) transcription(ctx context.Context, bot *tgbotapi.BotAPI, message, sentMsg *tgbotapi.Message, filepath string, chat settings.Settings) (*stt.Transcription, error) {
+	lang := chat.Language
+	ctx = stt.WithProgress(ctx, v.progressReporter(bot, message.Chat.ID, sentMsg.MessageID, lang))
+
+	result, err := v.stts.TransformSpeechToText(ctx, filepath, stt.Options{Language: chat.SpeechLanguage})
 	if err != nil {
 		v.logger.Error("error in transcription", zap.String("file path", filepath), zap.Error(err))
-		if err := utils.EditMessage(bot, message.Chat.ID, sentMsg.MessageID, "Ошибка транскрипции в текст :("); err != nil {
-			return "", fmt.Errorf("error in edit message: %v", err)
+		return nil, v.transcriptionFailed(ctx, bot, message, sentMsg, lang, err)
+	}
+
+	return &result, nil
+}
+
+// transcriptionFailed counts the failure and tells the user about it.
+func (v SpeechToTextUpdateHandler) transcriptionFailed(ctx context.Context, bot *tgbotapi.BotAPI, message, sentMsg *tgbotapi.Message, lang string, err error) error {
+	key := "transcription_error"
+	switch {
+	case errors.Is(context.Cause(ctx), errCanceledByUser):
+		key = "transcription_canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		key = "transcription_timeout"
+	case errors.Is(err, context.Canceled):
+		key = "bot_restarting"
+	case errors.Is(err, stt.ErrServiceUnavailable):
+		key = "service_unavailable"
+	}
+	text := v.catalog.Text(lang, key)
+
+	if errors.Is(context.Cause(ctx), errCanceledByUser) {
+		v.stats.canceled.Add(1)
+	} else {
+		v.stats.failed.Add(1)
+	}
+
+	if err := utils.EditMessage(bot, message.Chat.ID, sentMsg.MessageID, text); err != nil {
+		return fmt.Errorf("error in edit message: %w", err)
+	}
+	return nil
+}
+
+func (v SpeechToTextUpdateHandler) displayText(t stt.Transcription, chat settings.Settings) string {
+	if t.Text == "" {
+		return v.catalog.Text(chat.Language, "empty_transcription")
+	}
+
+	text := t.Text
+	if chat.Timestamps {
+		text = subtitles.Timestamped(t)
+	}
+	if chat.CleanPunctuation {
+		text = utils.CleanPunctuation(text)
+	}
+	return text
+}
+
+const progressEditInterval = 2 * time.Second
+
+// progressReporter edits the placeholder while a long audio is transcribed
+// in parts, not more often than progressEditInterval.
+func (v SpeechToTextUpdateHandler) progressReporter(bot *tgbotapi.BotAPI, chatID int64, messageID int, lang string) stt.ProgressFunc {
+	var lastEdit time.Time
+
+	return func(done, total int) {
+		if done != 0 && done != total && time.Since(lastEdit) < progressEditInterval {
+			return
 		}
-		return "", nil
+		lastEdit = time.Now()
+
+		text := v.catalog.Text(lang, "progress", done, total)
+		if err := utils.EditMessage(bot, chatID, messageID, text); err != nil {
+			v.logger.Warn("Failed to edit progress message", zap.Error(err))
+		}
+	}
+}
+
+// RateLimitedHandle tells the user to slow down instead of handling a message.
+func (v *SpeechToTextUpdateHandler) RateLimitedHandle(ctx context.Context, bot *tgbotapi.BotAPI, update *tgbotapi.Update) error {
+	switch {
+	case update.Message != nil:
+		v.logger.Info("Message rate limited", zap.Int64("chat_id", update.Message.Chat.ID))
+		lang := v.locale(update.Message.Chat.ID, update.Message.From)
+		return utils.SendTextReply(bot, update.Message.Chat.ID, update.Message.MessageID,
+			v.catalog.Text(lang, "rate_limited_message"))
+	case update.CallbackQuery != nil:
+		lang := v.callbackLocale(update.CallbackQuery)
+		return utils.AnswerCallback(bot, update.CallbackQuery.ID, v.catalog.Text(lang, "rate_limited_callback"))
+	default:
+		return nil
+	}
+}
+
+// chatSettings returns the settings of the chat with Language resolved to
+// a catalog locale: the one chosen in the chat, otherwise the Telegram
+// language of the user. A speech language no longer configured is dropped.
+// The defaults are used if the settings can't be read.
+func (v SpeechToTextUpdateHandler) chatSettings(chatID int64, from *tgbotapi.User) settings.Settings {
+	s, err := v.settings.Get(chatID)
+	if err != nil {
+		v.logger.Warn("Failed to read chat settings", zap.Int64("chat_id", chatID), zap.Error(err))
 	}
 
-	if transcription == "" {
-		transcription = "Текста в аудио нету."
+	if !v.catalog.Has(s.Language) {
+		s.Language = v.catalog.Fallback()
+		if from != nil {
+			s.Language = v.catalog.Match(from.LanguageCode)
+		}
+	}
+	if !v.isSpeechLanguage(s.SpeechLanguage) {
+		s.SpeechLanguage = ""
 	}
+	return s
+}
+
+func (v SpeechToTextUpdateHandler) isSpeechLanguage(lang string) bool {
+	return slices.Contains(v.speechLanguages, lang)
+}
+
+func (v SpeechToTextUpdateHandler) locale(chatID int64, from *tgbotapi.User) string {
+	return v.chatSettings(chatID, from).Language
+}
 
-	return transcription, nil
+func (v SpeechToTextUpdateHandler) callbackLocale(query *tgbotapi.CallbackQuery) string {
+	chatID := query.From.ID
+	if query.Message != nil {
+		chatID = query.Message.Chat.ID
+	}
+	return v.locale(chatID, query.From)
 }
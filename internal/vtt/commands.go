@@ -0,0 +1,183 @@
+package vtt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+
+	"tg-bot-voice-to-text/internal/vtt/settings"
+	"tg-bot-voice-to-text/pkg/botwork"
+	"tg-bot-voice-to-text/pkg/utils"
+)
+
+// commands are the bot commands in the order of the menu; their
+// descriptions are the command_<name> catalog texts.
+var commands = []string{"start", "help", "settings", "lang", "stats", "cancel"}
+
+// CommandHandler answers the bot commands in the language of the chat.
+type CommandHandler struct {
+	logger *zap.Logger
+	vtt    *SpeechToTextUpdateHandler
+}
+
+func NewCommandHandler(logger *zap.Logger, vtt *SpeechToTextUpdateHandler) *CommandHandler {
+	return &CommandHandler{
+		logger: logger.Named("commands"),
+		vtt:    vtt,
+	}
+}
+
+// Register adds the commands to the router. /cancel skips the queue of its
+// chat, otherwise it would wait for the transcription it cancels.
+func (c *CommandHandler) Register(r *botwork.Router) {
+	r.Command("start", botwork.HandlerFunc(c.start))
+	r.Command("help", botwork.HandlerFunc(c.help))
+	r.Command("settings", botwork.HandlerFunc(c.settings))
+	r.Command("lang", botwork.HandlerFunc(c.lang))
+	r.Command("stats", botwork.HandlerFunc(c.stats))
+	r.Command("cancel", botwork.HandlerFunc(c.cancel))
+	r.OutOfOrder("cancel")
+	r.Callback(settingsCallbackPrefix, botwork.HandlerFunc(c.settingsCallback))
+	r.OnInit(c.setMyCommands)
+}
+
+// setMyCommands registers the command descriptions with Telegram: in the
+// fallback language by default and in the others for users with that
+// language. A failure is logged only, the commands work without the menu.
+func (c *CommandHandler) setMyCommands(ctx context.Context, bot *tgbotapi.BotAPI) error {
+	catalog := c.vtt.catalog
+	for _, lang := range catalog.Languages() {
+		descriptions := make([]tgbotapi.BotCommand, 0, len(commands))
+		for _, name := range commands {
+			descriptions = append(descriptions, tgbotapi.BotCommand{
+				Command:     name,
+				Description: catalog.Text(lang, "command_"+name),
+			})
+		}
+
+		config := tgbotapi.NewSetMyCommands(descriptions...)
+		if lang != catalog.Fallback() {
+			config = tgbotapi.NewSetMyCommandsWithScopeAndLanguage(tgbotapi.NewBotCommandScopeDefault(), lang, descriptions...)
+		}
+
+		if _, err := bot.Request(config); err != nil {
+			c.logger.Warn("Failed to set bot commands", zap.String("language", lang), zap.Error(err))
+			continue
+		}
+		c.logger.Info("Bot commands set", zap.String("language", lang))
+	}
+	return nil
+}
+
+func (c *CommandHandler) reply(bot *tgbotapi.BotAPI, message *tgbotapi.Message, text string) error {
+	if err := utils.SendTextReply(bot, message.Chat.ID, message.MessageID, text); err != nil {
+		return fmt.Errorf("error in reply to /%s: %w", message.Command(), err)
+	}
+	return nil
+}
+
+// text is the catalog text in the language of the chat of the message.
+func (c *CommandHandler) text(message *tgbotapi.Message, key string, args ...any) string {
+	return c.vtt.catalog.Text(c.vtt.locale(message.Chat.ID, message.From), key, args...)
+}
+
+func (c *CommandHandler) start(ctx context.Context, bot *tgbotapi.BotAPI, update *tgbotapi.Update) error {
+	return c.reply(bot, update.Message, c.text(update.Message, "start")+"\n\n"+c.helpText(update.Message))
+}
+
+func (c *CommandHandler) help(ctx context.Context, bot *tgbotapi.BotAPI, update *tgbotapi.Update) error {
+	return c.reply(bot, update.Message, c.helpText(update.Message))
+}
+
+func (c *CommandHandler) helpText(message *tgbotapi.Message) string {
+	var b strings.Builder
+	for i, name := range commands {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "/%s — %s", name, c.text(message, "command_"+name))
+	}
+	return b.String()
+}
+
+// lang sets the interface language of the chat. As a reply to an audio it
+// transcribes that audio once with the given speech language instead; "auto"
+// leaves the language to the backend. Without an argument it shows the usage.
+func (c *CommandHandler) lang(ctx context.Context, bot *tgbotapi.BotAPI, update *tgbotapi.Update) error {
+	catalog := c.vtt.catalog
+
+	lang := strings.ToLower(strings.TrimSpace(update.Message.CommandArguments()))
+	if reply := update.Message.ReplyToMessage; reply != nil && lang != "" {
+		if speech := parseSpeechArg(lang); speech == "" || c.vtt.isSpeechLanguage(speech) {
+			if _, _, state := c.vtt.chooseReactionOnMessage(reply, catalog.Fallback()); state != skipMessage {
+				return c.transcribeIn(ctx, bot, update.Message, speech)
+			}
+		}
+	}
+
+	if !catalog.Has(lang) {
+		available := make([]string, 0, len(catalog.Languages()))
+		for _, l := range catalog.Languages() {
+			available = append(available, "/lang "+l)
+		}
+		return c.reply(bot, update.Message, c.text(update.Message, "lang_usage",
+			c.text(update.Message, "language_name"), strings.Join(available, ", "),
+			strings.Join(append([]string{speechAuto}, c.vtt.speechLanguages...), ", ")))
+	}
+
+	_, err := c.vtt.settings.Update(update.Message.Chat.ID, func(s *settings.Settings) {
+		s.Language = lang
+	})
+	if err != nil {
+		return fmt.Errorf("error in set chat language: %w", err)
+	}
+	c.logger.Info("Chat language set",
+		zap.Int64("chat_id", update.Message.Chat.ID),
+		zap.String("language", lang))
+	return c.reply(bot, update.Message, catalog.Text(lang, "lang_set"))
+}
+
+// transcribeIn transcribes the audio the command replies to with the speech
+// language, the settings of the chat are not changed.
+func (c *CommandHandler) transcribeIn(ctx context.Context, bot *tgbotapi.BotAPI, command *tgbotapi.Message, speechLanguage string) error {
+	chat := c.vtt.chatSettings(command.Chat.ID, command.From)
+	chat.SpeechLanguage = speechLanguage
+
+	c.logger.Info("One-off transcription requested",
+		zap.Int64("chat_id", command.Chat.ID),
+		zap.Int("message_id", command.ReplyToMessage.MessageID),
+		zap.String("speech_language", speechLanguage))
+	return c.vtt.transcribeMessage(ctx, bot, command.ReplyToMessage, chat)
+}
+
+func (c *CommandHandler) stats(ctx context.Context, bot *tgbotapi.BotAPI, update *tgbotapi.Update) error {
+	s := c.vtt.stats
+
+	text := c.text(update.Message, "stats",
+		s.started.Format("2006-01-02 15:04"),
+		time.Since(s.started).Truncate(time.Second),
+		s.messages.Load(),
+		s.transcribed.Load(),
+		s.cacheHits.Load(),
+		s.failed.Load(),
+		s.canceled.Load(),
+		(time.Duration(s.audioMillis.Load()) * time.Millisecond).Truncate(time.Second),
+		c.vtt.inFlight.count())
+	return c.reply(bot, update.Message, text)
+}
+
+func (c *CommandHandler) cancel(ctx context.Context, bot *tgbotapi.BotAPI, update *tgbotapi.Update) error {
+	n := c.vtt.inFlight.cancel(update.Message.Chat.ID)
+	if n == 0 {
+		return c.reply(bot, update.Message, c.text(update.Message, "nothing_to_cancel"))
+	}
+
+	c.logger.Info("Transcriptions canceled",
+		zap.Int64("chat_id", update.Message.Chat.ID),
+		zap.Int("count", n))
+	return c.reply(bot, update.Message, c.text(update.Message, "canceled", n))
+}
@@ -0,0 +1,33 @@
+package vtt
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"tg-bot-voice-to-text/pkg/utils"
+)
+
+// deliverText puts text into the placeholder message. Text longer than one
+// message continues in threaded replies to the placeholder; text longer than
+// textDocumentLength is sent as a .txt document instead. The keyboard always
+// stays on the placeholder, which replies to the original audio.
+func (v *SpeechToTextUpdateHandler) deliverText(bot *tgbotapi.BotAPI, chatID int64, messageID int, text string, keyboard *tgbotapi.InlineKeyboardMarkup, lang string) error {
+	if utils.TextLength(text) > v.textDocumentLength {
+		if err := editMessage(bot, chatID, messageID, v.catalog.Text(lang, "text_as_document"), keyboard); err != nil {
+			return err
+		}
+		return utils.SendDocumentReply(bot, chatID, messageID, "transcription.txt", []byte(text))
+	}
+
+	parts := utils.SplitText(text, utils.MaxMessageLength)
+	if err := editMessage(bot, chatID, messageID, parts[0], keyboard); err != nil {
+		return err
+	}
+	return utils.SendThreadedReplies(bot, chatID, messageID, parts[1:])
+}
+
+func editMessage(bot *tgbotapi.BotAPI, chatID int64, messageID int, text string, keyboard *tgbotapi.InlineKeyboardMarkup) error {
+	if keyboard == nil {
+		return utils.EditMessage(bot, chatID, messageID, text)
+	}
+	return utils.EditMessageWithKeyboard(bot, chatID, messageID, text, *keyboard)
+}
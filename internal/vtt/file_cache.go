@@ -0,0 +1,148 @@
+package vtt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"tg-bot-voice-to-text/internal/vtt/stt"
+	"tg-bot-voice-to-text/pkg/cache"
+)
+
+// mediaFile is the Telegram file of a media message. ID is valid for this
+// bot only; UniqueID is the same for every bot, but changes when the audio
+// is uploaded again.
+type mediaFile struct {
+	ID       string
+	UniqueID string
+}
+
+// errWaitingForAudio wraps the context error of a transcription that gave up
+// waiting for the same audio being transcribed for another message.
+var errWaitingForAudio = errors.New("error in wait for the same audio")
+
+// transcriptionCache keeps the results by the SHA-256 of the audio, so the
+// same audio forwarded from another bot or uploaded again is transcribed
+// once. The file_id and file_unique_id of a file are aliases of its hash,
+// they find a result before the file is downloaded. Each audio takes up to
+// three entries of the underlying cache.
+type transcriptionCache struct {
+	cache cache.Cache[string, string]
+	locks *keyedLock // by hash
+}
+
+func newTranscriptionCache(cache cache.Cache[string, string]) transcriptionCache {
+	return transcriptionCache{cache: cache, locks: newKeyedLock()}
+}
+
+func (c transcriptionCache) hash(file mediaFile) (string, bool) {
+	if hash, ok := c.cache.Get("file_id:" + file.ID); ok {
+		return hash, true
+	}
+	if file.UniqueID == "" {
+		return "", false
+	}
+	return c.cache.Get("file_unique_id:" + file.UniqueID)
+}
+
+// lookup finds the result for a file by its aliases.
+func (c transcriptionCache) lookup(file mediaFile, speechLanguage string) (stt.Transcription, bool) {
+	hash, ok := c.hash(file)
+	if !ok {
+		return stt.Transcription{}, false
+	}
+	return c.get(hash, speechLanguage)
+}
+
+func (c transcriptionCache) get(hash, speechLanguage string) (stt.Transcription, bool) {
+	cached, ok := c.cache.Get(resultKey(hash, speechLanguage))
+	if !ok {
+		return stt.Transcription{}, false
+	}
+	return stt.DecodeTranscription(cached), true
+}
+
+// link makes the IDs of a downloaded file aliases of its hash.
+func (c transcriptionCache) link(file mediaFile, hash string) {
+	c.cache.Add("file_id:"+file.ID, hash)
+	if file.UniqueID != "" {
+		c.cache.Add("file_unique_id:"+file.UniqueID, hash)
+	}
+}
+
+func (c transcriptionCache) add(hash, speechLanguage string, t stt.Transcription) {
+	c.cache.Add(resultKey(hash, speechLanguage), stt.EncodeTranscription(t))
+}
+
+// resolve returns the cached result for the audio, cached is then true.
+// Otherwise it runs transcribe and caches a non-nil result; meanwhile
+// resolve for the same audio waits, so that it takes the result from the
+// cache instead of transcribing it again.
+func (c transcriptionCache) resolve(ctx context.Context, hash, speechLanguage string, transcribe func() (*stt.Transcription, error)) (result *stt.Transcription, cached bool, err error) {
+	unlock, err := c.locks.lock(ctx, hash)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %w", errWaitingForAudio, err)
+	}
+	defer unlock()
+
+	if t, ok := c.get(hash, speechLanguage); ok {
+		return &t, true, nil
+	}
+
+	result, err = transcribe()
+	if err != nil || result == nil {
+		return nil, false, err
+	}
+	c.add(hash, speechLanguage, *result)
+	return result, false, nil
+}
+
+// resultKey is the key of a result: the same audio transcribed with another
+// speech language hint is a different result.
+func resultKey(hash, speechLanguage string) string {
+	key := "sha256:" + hash
+	if speechLanguage != "" {
+		key += "|" + speechLanguage
+	}
+	return key
+}
+
+// keyedLock lets one transcription of the same audio run at a time, so
+// another chat sending it meanwhile waits and takes the result from the
+// cache.
+type keyedLock struct {
+	mu   sync.Mutex
+	held map[string]chan struct{}
+}
+
+func newKeyedLock() *keyedLock {
+	return &keyedLock{held: make(map[string]chan struct{})}
+}
+
+// lock waits until the key is free or ctx is done.
+func (l *keyedLock) lock(ctx context.Context, key string) (unlock func(), err error) {
+	for {
+		l.mu.Lock()
+		released, busy := l.held[key]
+		if !busy {
+			released = make(chan struct{})
+			l.held[key] = released
+			l.mu.Unlock()
+
+			return func() {
+				l.mu.Lock()
+				delete(l.held, key)
+				l.mu.Unlock()
+				close(released)
+			}, nil
+		}
+		l.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
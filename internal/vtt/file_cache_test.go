@@ -0,0 +1,191 @@
+package vtt
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"tg-bot-voice-to-text/internal/vtt/stt"
+)
+
+func newTestTranscriptionCache(t *testing.T) transcriptionCache {
+	c, err := lru.New[string, string](100)
+	require.NoError(t, err)
+	return newTranscriptionCache(c)
+}
+
+// transcriber counts the calls and returns text, optionally waiting for
+// release first.
+type transcriber struct {
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (tr *transcriber) transcribe(text string) func() (*stt.Transcription, error) {
+	return func() (*stt.Transcription, error) {
+		tr.calls.Add(1)
+		if tr.release != nil {
+			<-tr.release
+		}
+		return &stt.Transcription{Text: text}, nil
+	}
+}
+
+func TestTranscriptionCacheTranscribesSameAudioOnce(t *testing.T) {
+	c := newTestTranscriptionCache(t)
+	tr := &transcriber{release: make(chan struct{})}
+
+	type resolved struct {
+		text   string
+		cached bool
+	}
+	results := make(chan resolved, 2)
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, cached, err := c.resolve(context.Background(), "hash", "", tr.transcribe("text"))
+			assert.NoError(t, err)
+			results <- resolved{result.Text, cached}
+		}()
+	}
+
+	assert.Eventually(t, func() bool { return tr.calls.Load() == 1 }, time.Second, time.Millisecond)
+	close(tr.release)
+	wg.Wait()
+	close(results)
+
+	assert.Equal(t, int32(1), tr.calls.Load(), "the second lookup waits for the first transcription")
+	var got []resolved
+	for r := range results {
+		got = append(got, r)
+	}
+	assert.ElementsMatch(t, []resolved{{"text", false}, {"text", true}}, got)
+}
+
+func TestTranscriptionCacheHitByAnotherFile(t *testing.T) {
+	c := newTestTranscriptionCache(t)
+	tr := &transcriber{}
+
+	first := mediaFile{ID: "id-1", UniqueID: "unique-1"}
+	_, ok := c.lookup(first, "")
+	assert.False(t, ok)
+
+	c.link(first, "hash")
+	_, cached, err := c.resolve(context.Background(), "hash", "", tr.transcribe("text"))
+	require.NoError(t, err)
+	assert.False(t, cached)
+
+	result, ok := c.lookup(first, "")
+	assert.True(t, ok)
+	assert.Equal(t, "text", result.Text)
+
+	// the same file seen by another bot: another file_id, the same file_unique_id
+	result, ok = c.lookup(mediaFile{ID: "id-2", UniqueID: "unique-1"}, "")
+	assert.True(t, ok)
+	assert.Equal(t, "text", result.Text)
+
+	// the same audio uploaded again: new IDs, found by the content once downloaded
+	reuploaded := mediaFile{ID: "id-3", UniqueID: "unique-3"}
+	_, ok = c.lookup(reuploaded, "")
+	assert.False(t, ok)
+
+	c.link(reuploaded, "hash")
+	got, cached, err := c.resolve(context.Background(), "hash", "", tr.transcribe("other"))
+	require.NoError(t, err)
+	assert.True(t, cached)
+	assert.Equal(t, "text", got.Text)
+	assert.Equal(t, int32(1), tr.calls.Load())
+
+	_, ok = c.lookup(reuploaded, "")
+	assert.True(t, ok, "the new IDs are aliases now")
+}
+
+func TestTranscriptionCacheKeysBySpeechLanguage(t *testing.T) {
+	c := newTestTranscriptionCache(t)
+	tr := &transcriber{}
+	file := mediaFile{ID: "id", UniqueID: "unique"}
+	c.link(file, "hash")
+
+	for _, lang := range []string{"ru", "en", ""} {
+		result, cached, err := c.resolve(context.Background(), "hash", lang, tr.transcribe("text "+lang))
+		require.NoError(t, err)
+		assert.False(t, cached, "language %q", lang)
+		assert.Equal(t, "text "+lang, result.Text)
+	}
+	assert.Equal(t, int32(3), tr.calls.Load())
+
+	for _, lang := range []string{"ru", "en", ""} {
+		result, ok := c.lookup(file, lang)
+		assert.True(t, ok)
+		assert.Equal(t, "text "+lang, result.Text)
+	}
+	_, ok := c.lookup(file, "kk")
+	assert.False(t, ok)
+}
+
+func TestTranscriptionCacheSkipsFailedTranscription(t *testing.T) {
+	c := newTestTranscriptionCache(t)
+
+	result, cached, err := c.resolve(context.Background(), "hash", "", func() (*stt.Transcription, error) {
+		return nil, nil // the failure was shown to the user
+	})
+	require.NoError(t, err)
+	assert.Nil(t, result)
+	assert.False(t, cached)
+
+	_, ok := c.get("hash", "")
+	assert.False(t, ok)
+}
+
+func TestKeyedLockCanceled(t *testing.T) {
+	l := newKeyedLock()
+	unlock, err := l.lock(context.Background(), "key")
+	require.NoError(t, err)
+
+	other, err := l.lock(context.Background(), "other")
+	require.NoError(t, err, "other keys are not blocked")
+	other()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	locked := make(chan error, 1)
+	go func() {
+		_, err := l.lock(ctx, "key")
+		locked <- err
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("lock of a held key returned")
+	case <-time.After(20 * time.Millisecond):
+	}
+	cancel()
+	assert.ErrorIs(t, <-locked, context.Canceled)
+
+	unlock()
+	unlock, err = l.lock(context.Background(), "key")
+	require.NoError(t, err)
+	unlock()
+}
+
+func TestTranscriptionCacheWaitCanceled(t *testing.T) {
+	c := newTestTranscriptionCache(t)
+	unlock, err := c.locks.lock(context.Background(), "hash")
+	require.NoError(t, err)
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	tr := &transcriber{}
+	_, _, err = c.resolve(ctx, "hash", "", tr.transcribe("text"))
+	assert.ErrorIs(t, err, errWaitingForAudio)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Zero(t, tr.calls.Load())
+}
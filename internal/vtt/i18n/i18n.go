@@ -0,0 +1,113 @@
+// Package i18n holds the texts of the bot replies in several languages,
+// loaded from <lang>.yml files of a directory.
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Catalog is a set of locales, every one having the keys of the fallback
+// locale.
+type Catalog struct {
+	fallback string
+	locales  map[string]map[string]string
+}
+
+// Load reads every .yml and .yaml file of dir as a locale named after the
+// file, e.g. en.yml. A locale missing a key of the fallback one is an error,
+// so a forgotten translation is found on start.
+func Load(dir, fallback string) (*Catalog, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error in read locales dir: %w", err)
+	}
+
+	c := &Catalog{fallback: fallback, locales: make(map[string]map[string]string)}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || ext != ".yml" && ext != ".yaml" {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error in read locale: %w", err)
+		}
+		messages := make(map[string]string)
+		if err := yaml.Unmarshal(data, &messages); err != nil {
+			return nil, fmt.Errorf("error in parse locale %s: %w", entry.Name(), err)
+		}
+		c.locales[strings.TrimSuffix(entry.Name(), ext)] = messages
+	}
+
+	base, ok := c.locales[fallback]
+	if !ok {
+		return nil, fmt.Errorf("no locale file for fallback language %q in %s", fallback, dir)
+	}
+	for lang, messages := range c.locales {
+		for key := range base {
+			if _, ok := messages[key]; !ok {
+				return nil, fmt.Errorf("locale %s: missing key %q", lang, key)
+			}
+		}
+	}
+
+	return c, nil
+}
+
+func (c *Catalog) Fallback() string {
+	return c.fallback
+}
+
+// Languages returns the loaded locales, sorted.
+func (c *Catalog) Languages() []string {
+	langs := make([]string, 0, len(c.locales))
+	for lang := range c.locales {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+func (c *Catalog) Has(lang string) bool {
+	_, ok := c.locales[lang]
+	return ok
+}
+
+// Match returns the locale for a Telegram language_code such as "en" or
+// "pt-br", or the fallback one.
+func (c *Catalog) Match(languageCode string) string {
+	code := strings.ToLower(languageCode)
+	if c.Has(code) {
+		return code
+	}
+	if base, _, ok := strings.Cut(code, "-"); ok && c.Has(base) {
+		return base
+	}
+	return c.fallback
+}
+
+// Text returns the message of the locale formatted with args like
+// fmt.Sprintf. An unknown locale falls back to the fallback one, an unknown
+// key is returned as is.
+func (c *Catalog) Text(lang, key string, args ...any) string {
+	messages, ok := c.locales[lang]
+	if !ok {
+		messages = c.locales[c.fallback]
+	}
+
+	text, ok := messages[key]
+	if !ok {
+		return key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
@@ -0,0 +1,58 @@
+package i18n
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeLocales(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, data := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(data), 0644))
+	}
+	return dir
+}
+
+func TestCatalog(t *testing.T) {
+	dir := writeLocales(t, map[string]string{
+		"ru.yml":    "hello: \"Привет\"\nprogress: \"%d/%d\"\n",
+		"en.yaml":   "hello: \"Hello\"\nprogress: \"%d of %d\"\n",
+		"notes.txt": "not a locale",
+	})
+
+	c, err := Load(dir, "ru")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"en", "ru"}, c.Languages())
+	assert.Equal(t, "Hello", c.Text("en", "hello"))
+	assert.Equal(t, "1 of 3", c.Text("en", "progress", 1, 3))
+	assert.Equal(t, "Привет", c.Text("de", "hello"), "unknown locale falls back")
+	assert.Equal(t, "missing", c.Text("en", "missing"))
+
+	assert.Equal(t, "en", c.Match("en"))
+	assert.Equal(t, "en", c.Match("en-GB"))
+	assert.Equal(t, "ru", c.Match("de"))
+	assert.Equal(t, "ru", c.Match(""))
+}
+
+func TestLoadRejectsIncompleteLocales(t *testing.T) {
+	dir := writeLocales(t, map[string]string{
+		"ru.yml": "hello: \"Привет\"\nbye: \"Пока\"\n",
+		"en.yml": "hello: \"Hello\"\n",
+	})
+	_, err := Load(dir, "ru")
+	assert.ErrorContains(t, err, `locale en: missing key "bye"`)
+
+	_, err = Load(dir, "de")
+	assert.Error(t, err)
+}
+
+func TestShippedLocales(t *testing.T) {
+	c, err := Load("../../../configs/locales", "ru")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"en", "ru"}, c.Languages())
+}
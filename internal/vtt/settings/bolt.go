@@ -0,0 +1,90 @@
+package settings
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var chatsBucket = []byte("chats")
+
+type boltStore struct {
+	defaults Settings
+	db       *bolt.DB
+}
+
+// NewBoltStore keeps the settings in a bbolt file at path, as JSON by chat
+// ID. The file is locked while the store is open.
+func NewBoltStore(path string, defaults Settings) (Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("error in creating settings directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error in open settings db: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(chatsBucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("error in creating settings bucket: %w", err)
+	}
+
+	return &boltStore{defaults: defaults, db: db}, nil
+}
+
+func chatKey(chatID int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(chatID))
+}
+
+func (b *boltStore) Get(chatID int64) (Settings, error) {
+	s := b.defaults
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return b.read(tx, chatID, &s)
+	})
+	return s, err
+}
+
+func (b *boltStore) Update(chatID int64, fn func(s *Settings)) (Settings, error) {
+	s := b.defaults
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		if err := b.read(tx, chatID, &s); err != nil {
+			return err
+		}
+		fn(&s)
+
+		data, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(chatsBucket).Put(chatKey(chatID), data)
+	})
+	if err != nil {
+		return s, fmt.Errorf("error in saving settings of chat %d: %w", chatID, err)
+	}
+	return s, nil
+}
+
+func (b *boltStore) read(tx *bolt.Tx, chatID int64, s *Settings) error {
+	data := tx.Bucket(chatsBucket).Get(chatKey(chatID))
+	if data == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return fmt.Errorf("error in decoding settings of chat %d: %w", chatID, err)
+	}
+	return nil
+}
+
+func (b *boltStore) Close() error {
+	return b.db.Close()
+}
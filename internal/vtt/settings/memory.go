@@ -0,0 +1,42 @@
+package settings
+
+import "sync"
+
+type memoryStore struct {
+	defaults Settings
+
+	mu    sync.RWMutex
+	chats map[int64]Settings
+}
+
+// NewMemoryStore keeps the settings until the process exits.
+func NewMemoryStore(defaults Settings) Store {
+	return &memoryStore{defaults: defaults, chats: make(map[int64]Settings)}
+}
+
+func (m *memoryStore) Get(chatID int64) (Settings, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if s, ok := m.chats[chatID]; ok {
+		return s, nil
+	}
+	return m.defaults, nil
+}
+
+func (m *memoryStore) Update(chatID int64, fn func(s *Settings)) (Settings, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.chats[chatID]
+	if !ok {
+		s = m.defaults
+	}
+	fn(&s)
+	m.chats[chatID] = s
+	return s, nil
+}
+
+func (m *memoryStore) Close() error {
+	return nil
+}
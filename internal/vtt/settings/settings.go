@@ -0,0 +1,23 @@
+// Package settings keeps the per-chat settings of the bot.
+package settings
+
+// Settings of one chat. Zero values of strings mean "not chosen": Language
+// then follows the Telegram language of the user, SpeechLanguage leaves the
+// language of the audio to the backend.
+type Settings struct {
+	Language         string `json:"language,omitempty"`        // interface language, a catalog locale
+	SpeechLanguage   string `json:"speech_language,omitempty"` // hint for the backend, e.g. ru
+	SubtitleFormat   string `json:"subtitle_format,omitempty"` // file sent after a transcription, empty sends none
+	AutoTranscribe   bool   `json:"auto_transcribe"`           // transcribe every audio in groups, not only in private chats
+	Timestamps       bool   `json:"timestamps"`                // segment timestamps in the transcription text
+	CleanPunctuation bool   `json:"clean_punctuation"`         // see utils.CleanPunctuation
+}
+
+// Store keeps the settings by chat ID. A chat without stored settings gets
+// the defaults the store was created with.
+type Store interface {
+	Get(chatID int64) (Settings, error)
+	// Update changes the settings of the chat with fn and stores them.
+	Update(chatID int64, fn func(s *Settings)) (Settings, error)
+	Close() error
+}
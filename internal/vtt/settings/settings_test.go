@@ -0,0 +1,56 @@
+package settings
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var defaults = Settings{SubtitleFormat: "srt", AutoTranscribe: true}
+
+func testStore(t *testing.T, store Store) {
+	s, err := store.Get(1)
+	require.NoError(t, err)
+	assert.Equal(t, defaults, s)
+
+	s, err = store.Update(1, func(s *Settings) {
+		s.Language = "en"
+		s.SpeechLanguage = "kk"
+		s.Timestamps = true
+	})
+	require.NoError(t, err)
+	assert.Equal(t, Settings{Language: "en", SpeechLanguage: "kk", SubtitleFormat: "srt", AutoTranscribe: true, Timestamps: true}, s)
+
+	got, err := store.Get(1)
+	require.NoError(t, err)
+	assert.Equal(t, s, got)
+
+	got, err = store.Get(-100123)
+	require.NoError(t, err)
+	assert.Equal(t, defaults, got, "other chats keep the defaults")
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore(defaults))
+}
+
+func TestBoltStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "settings.db")
+
+	store, err := NewBoltStore(path, defaults)
+	require.NoError(t, err)
+	testStore(t, store)
+	require.NoError(t, store.Close())
+
+	store, err = NewBoltStore(path, defaults)
+	require.NoError(t, err)
+	defer store.Close()
+
+	s, err := store.Get(1)
+	require.NoError(t, err)
+	assert.Equal(t, "en", s.Language, "settings survive a reopen")
+	assert.Equal(t, "kk", s.SpeechLanguage)
+	assert.True(t, s.Timestamps)
+}
@@ -0,0 +1,204 @@
+package vtt
+
+import (
+	"context"
+	"fmt"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+
+	"tg-bot-voice-to-text/internal/vtt/settings"
+	"tg-bot-voice-to-text/internal/vtt/subtitles"
+	"tg-bot-voice-to-text/pkg/botwork"
+	"tg-bot-voice-to-text/pkg/utils"
+)
+
+// Buttons of the settings menu: "settings:1:lang:en", "settings:1:speech:en"
+// (or "auto"), "settings:1:format:srt" (or "off") and
+// "settings:1:toggle:<timestamps|auto|punctuation>". Presses of other
+// versions get the current menu instead.
+const (
+	settingsCallbackPrefix  = "settings"
+	settingsCallbackVersion = 1
+
+	subtitlesOff = "off"
+	speechAuto   = "auto"
+)
+
+// speechArg is the button argument for a speech language, which is empty
+// when the backend detects it.
+func speechArg(lang string) string {
+	if lang == "" {
+		return speechAuto
+	}
+	return lang
+}
+
+func parseSpeechArg(arg string) string {
+	if arg == speechAuto {
+		return ""
+	}
+	return arg
+}
+
+// settings sends the settings of the chat with buttons to change them.
+func (c *CommandHandler) settings(ctx context.Context, bot *tgbotapi.BotAPI, update *tgbotapi.Update) error {
+	chat := c.vtt.chatSettings(update.Message.Chat.ID, update.Message.From)
+
+	text, keyboard, err := c.settingsMenu(chat)
+	if err != nil {
+		return err
+	}
+
+	msg := tgbotapi.NewMessage(update.Message.Chat.ID, text)
+	msg.ReplyToMessageID = update.Message.MessageID
+	msg.ReplyMarkup = keyboard
+	if _, err := bot.Send(msg); err != nil {
+		return fmt.Errorf("error in send settings menu: %w", err)
+	}
+	return nil
+}
+
+// settingsCallback applies a press of a menu button and edits the menu in
+// place.
+func (c *CommandHandler) settingsCallback(ctx context.Context, bot *tgbotapi.BotAPI, update *tgbotapi.Update) error {
+	query := update.CallbackQuery
+	data, err := botwork.ParseCallbackData(query.Data)
+	if err != nil || query.Message == nil {
+		return utils.AnswerCallback(bot, query.ID, "")
+	}
+
+	chatID := query.Message.Chat.ID
+	log := c.logger.With(
+		zap.Int64("chat_id", chatID),
+		zap.String("data", query.Data))
+
+	before := c.vtt.chatSettings(chatID, query.From)
+	answer := ""
+
+	var apply func(s *settings.Settings)
+	if data.Version == settingsCallbackVersion {
+		apply = c.settingChange(data.Arg(0), data.Arg(1))
+	}
+	if apply == nil {
+		log.Info("Outdated settings button pressed", zap.Int("version", data.Version))
+		answer = c.vtt.catalog.Text(before.Language, "settings_outdated")
+	} else {
+		if _, err := c.vtt.settings.Update(chatID, apply); err != nil {
+			_ = utils.AnswerCallback(bot, query.ID, "")
+			return fmt.Errorf("error in update chat settings: %w", err)
+		}
+		log.Info("Chat settings changed")
+	}
+
+	after := c.vtt.chatSettings(chatID, query.From)
+	if after != before || apply == nil {
+		text, keyboard, err := c.settingsMenu(after)
+		if err != nil {
+			return err
+		}
+		if err := utils.EditMessageWithKeyboard(bot, chatID, query.Message.MessageID, text, keyboard); err != nil {
+			log.Warn("Failed to edit settings menu", zap.Error(err))
+		}
+	}
+
+	return utils.AnswerCallback(bot, query.ID, answer)
+}
+
+// settingChange returns the change of a button, nil for unknown buttons.
+func (c *CommandHandler) settingChange(name, value string) func(s *settings.Settings) {
+	switch name {
+	case "lang":
+		if c.vtt.catalog.Has(value) {
+			return func(s *settings.Settings) { s.Language = value }
+		}
+	case "speech":
+		if lang := parseSpeechArg(value); lang == "" || c.vtt.isSpeechLanguage(lang) {
+			return func(s *settings.Settings) { s.SpeechLanguage = lang }
+		}
+	case "format":
+		if value == subtitlesOff {
+			return func(s *settings.Settings) { s.SubtitleFormat = "" }
+		}
+		if subtitles.IsFormat(value) {
+			return func(s *settings.Settings) { s.SubtitleFormat = value }
+		}
+	case "toggle":
+		switch value {
+		case "timestamps":
+			return func(s *settings.Settings) { s.Timestamps = !s.Timestamps }
+		case "auto":
+			return func(s *settings.Settings) { s.AutoTranscribe = !s.AutoTranscribe }
+		case "punctuation":
+			return func(s *settings.Settings) { s.CleanPunctuation = !s.CleanPunctuation }
+		}
+	}
+	return nil
+}
+
+// settingsMenu returns the text and the buttons of the menu for the settings
+// of a chat; the current values are checked.
+func (c *CommandHandler) settingsMenu(chat settings.Settings) (string, tgbotapi.InlineKeyboardMarkup, error) {
+	catalog := c.vtt.catalog
+	text := func(key string, args ...any) string {
+		return catalog.Text(chat.Language, key, args...)
+	}
+	onOff := func(on bool) string {
+		if on {
+			return text("enabled")
+		}
+		return text("disabled")
+	}
+
+	var encodeErr error
+	button := func(label string, checked bool, args ...string) tgbotapi.InlineKeyboardButton {
+		data, err := botwork.NewCallbackData(settingsCallbackPrefix, settingsCallbackVersion, args...).Encode()
+		if err != nil {
+			encodeErr = err
+		}
+		if checked {
+			label = "✓ " + label
+		}
+		return tgbotapi.NewInlineKeyboardButtonData(label, data)
+	}
+
+	var languages []tgbotapi.InlineKeyboardButton
+	for _, lang := range catalog.Languages() {
+		languages = append(languages, button(catalog.Text(lang, "language_name"), lang == chat.Language, "lang", lang))
+	}
+
+	speech := []tgbotapi.InlineKeyboardButton{button(text("button_speech_auto"), chat.SpeechLanguage == "", "speech", speechAuto)}
+	for _, lang := range c.vtt.speechLanguages {
+		speech = append(speech, button(lang, lang == chat.SpeechLanguage, "speech", lang))
+	}
+
+	var formats []tgbotapi.InlineKeyboardButton
+	for _, format := range subtitles.Formats {
+		formats = append(formats, button("."+format, format == chat.SubtitleFormat, "format", format))
+	}
+	formats = append(formats, button(text("button_no_subtitles"), chat.SubtitleFormat == "", "format", subtitlesOff))
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		languages,
+		speech,
+		formats,
+		tgbotapi.NewInlineKeyboardRow(button(text("button_timestamps", onOff(chat.Timestamps)), false, "toggle", "timestamps")),
+		tgbotapi.NewInlineKeyboardRow(button(text("button_auto_transcribe", onOff(chat.AutoTranscribe)), false, "toggle", "auto")),
+		tgbotapi.NewInlineKeyboardRow(button(text("button_clean_punctuation", onOff(chat.CleanPunctuation)), false, "toggle", "punctuation")),
+	)
+	if encodeErr != nil {
+		return "", keyboard, fmt.Errorf("error in encode settings button: %w", encodeErr)
+	}
+
+	format := chat.SubtitleFormat
+	if format == "" {
+		format = text("subtitles_off")
+	}
+	speechLanguage := chat.SpeechLanguage
+	if speechLanguage == "" {
+		speechLanguage = text("speech_auto")
+	}
+	menu := text("settings", text("language_name"), speechLanguage, format,
+		onOff(chat.Timestamps), onOff(chat.AutoTranscribe), onOff(chat.CleanPunctuation))
+	return menu, keyboard, nil
+}
@@ -0,0 +1,217 @@
+package stt
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"go.uber.org/zap"
+)
+
+// maxOverlapWords bounds the search for text repeated at chunk borders.
+const maxOverlapWords = 30
+
+// STTServiceChunked splits long audio into overlapping chunks, transcribes
+// them in parallel with the inner service and stitches the texts in order.
+// Short audio, or audio that can not be probed or cut, goes to the inner
+// service as is.
+type STTServiceChunked struct {
+	logger *zap.Logger
+
+	inner         STTService
+	splitter      AudioSplitter
+	chunkDuration time.Duration
+	overlap       time.Duration
+}
+
+func NewSTTServiceChunked(logger *zap.Logger, inner STTService, splitter AudioSplitter, chunkDuration, overlap time.Duration) STTServiceChunked {
+	if overlap < 0 || overlap >= chunkDuration {
+		overlap = 0
+	}
+
+	logger.Info("Initializing chunked STT service",
+		zap.Duration("chunk_duration", chunkDuration),
+		zap.Duration("overlap", overlap))
+
+	return STTServiceChunked{
+		logger:        logger,
+		inner:         inner,
+		splitter:      splitter,
+		chunkDuration: chunkDuration,
+		overlap:       overlap,
+	}
+}
+
+func (s STTServiceChunked) TransformSpeechToText(ctx context.Context, filePath string, opts Options) (Transcription, error) {
+	log := s.logger.With(zap.String("file_path", filePath))
+
+	duration, err := s.splitter.Duration(ctx, filePath)
+	if err != nil {
+		log.Warn("Failed to get audio duration, transcribing as a whole", zap.Error(err))
+		return s.inner.TransformSpeechToText(ctx, filePath, opts)
+	}
+	if duration <= s.chunkDuration+s.overlap {
+		return s.inner.TransformSpeechToText(ctx, filePath, opts)
+	}
+
+	chunks := planChunks(duration, s.chunkDuration, s.overlap)
+	log = log.With(zap.Duration("duration", duration), zap.Int("chunks", len(chunks)))
+
+	paths, err := s.splitter.Split(ctx, filePath, chunks)
+	if err != nil {
+		if ctx.Err() != nil {
+			return Transcription{}, ctx.Err()
+		}
+		log.Warn("Failed to split audio, transcribing as a whole", zap.Error(err))
+		return s.inner.TransformSpeechToText(ctx, filePath, opts)
+	}
+	defer RemoveFiles(paths)
+
+	log.Info("Transcribing audio in chunks")
+	startTime := time.Now()
+
+	results, err := s.transcribeAll(ctx, paths, opts)
+	if err != nil {
+		log.Error("Chunked transcription failed", zap.Error(err))
+		return Transcription{}, err
+	}
+
+	result := mergeChunks(chunks, results, s.overlap)
+	result.Duration = duration.Seconds()
+
+	log.Info("Chunked transcription succeeded", zap.Duration("total_time", time.Since(startTime)))
+	return result, nil
+}
+
+func (s STTServiceChunked) transcribeAll(ctx context.Context, paths []string, opts Options) ([]Transcription, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]Transcription, len(paths))
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		done     int
+		firstErr error
+	)
+
+	reportProgress(ctx, 0, len(paths))
+
+	wg.Add(len(paths))
+	for i, path := range paths {
+		go func() {
+			defer wg.Done()
+
+			result, err := s.inner.TransformSpeechToText(ctx, path, opts)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+					cancel() // no point in finishing the other chunks
+				}
+				return
+			}
+
+			results[i] = result
+			done++
+			reportProgress(ctx, done, len(paths))
+		}()
+	}
+	wg.Wait()
+
+	return results, firstErr
+}
+
+func planChunks(duration, chunkDuration, overlap time.Duration) []Chunk {
+	step := chunkDuration - overlap
+
+	var chunks []Chunk
+	for start := time.Duration(0); start < duration; start += step {
+		length := min(chunkDuration, duration-start)
+		chunks = append(chunks, Chunk{Start: start, Length: length})
+
+		if start+length >= duration {
+			break
+		}
+	}
+	return chunks
+}
+
+// mergeChunks stitches chunk results in order. Texts are de-duplicated by
+// mergeOverlap; segments are shifted to the whole audio timeline and split
+// between neighbouring chunks at the middle of their overlap.
+func mergeChunks(chunks []Chunk, results []Transcription, overlap time.Duration) Transcription {
+	var merged Transcription
+
+	for i, result := range results {
+		merged.Text = mergeOverlap(merged.Text, result.Text)
+		if merged.Language == "" {
+			merged.Language = result.Language
+		}
+
+		offset := chunks[i].Start.Seconds()
+		from := offset + overlap.Seconds()/2
+		if i == 0 {
+			from = 0
+		}
+		to := math.Inf(1)
+		if i+1 < len(chunks) {
+			to = chunks[i+1].Start.Seconds() + overlap.Seconds()/2
+		}
+
+		for _, segment := range result.Segments {
+			segment.Start += offset
+			segment.End += offset
+			if segment.Start >= from && segment.Start < to {
+				merged.Segments = append(merged.Segments, segment)
+			}
+		}
+	}
+
+	return merged
+}
+
+// mergeOverlap appends next to prev dropping the longest run of words at the
+// start of next that repeats the end of prev (at least two words, so a single
+// common word is not taken for an overlap).
+func mergeOverlap(prev, next string) string {
+	prevWords := strings.Fields(prev)
+	nextWords := strings.Fields(next)
+
+	switch {
+	case len(nextWords) == 0:
+		return prev
+	case len(prevWords) == 0:
+		return strings.Join(nextWords, " ")
+	}
+
+	overlap := 0
+	for k := min(len(prevWords), len(nextWords), maxOverlapWords); k >= 2; k-- {
+		if sameWords(prevWords[len(prevWords)-k:], nextWords[:k]) {
+			overlap = k
+			break
+		}
+	}
+
+	return strings.Join(append(prevWords, nextWords[overlap:]...), " ")
+}
+
+func sameWords(a, b []string) bool {
+	for i := range a {
+		if normalizeWord(a[i]) != normalizeWord(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func normalizeWord(word string) string {
+	return strings.ToLower(strings.TrimFunc(word, unicode.IsPunct))
+}
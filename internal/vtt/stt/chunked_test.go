@@ -0,0 +1,124 @@
+package stt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type fakeSplitter struct {
+	duration time.Duration
+	chunks   []Chunk
+}
+
+func (f *fakeSplitter) Duration(context.Context, string) (time.Duration, error) {
+	return f.duration, nil
+}
+
+func (f *fakeSplitter) Split(_ context.Context, _ string, chunks []Chunk) ([]string, error) {
+	f.chunks = chunks
+	paths := make([]string, len(chunks))
+	for i := range chunks {
+		paths[i] = fmt.Sprintf("chunk%d", i)
+	}
+	return paths, nil
+}
+
+type fakeService func(ctx context.Context, filePath string) (string, error)
+
+func (f fakeService) TransformSpeechToText(ctx context.Context, filePath string, _ Options) (Transcription, error) {
+	text, err := f(ctx, filePath)
+	return TextTranscription(text), err
+}
+
+func TestPlanChunks(t *testing.T) {
+	chunks := planChunks(70*time.Second, 30*time.Second, 5*time.Second)
+
+	assert.Equal(t, []Chunk{
+		{Start: 0, Length: 30 * time.Second},
+		{Start: 25 * time.Second, Length: 30 * time.Second},
+		{Start: 50 * time.Second, Length: 20 * time.Second},
+	}, chunks)
+}
+
+func TestMergeOverlap(t *testing.T) {
+	assert.Equal(t, "раз два три четыре пять", mergeOverlap("раз два три", "Два, три четыре пять"))
+	assert.Equal(t, "и мы и они", mergeOverlap("и мы", "и они"), "one common word is not an overlap")
+	assert.Equal(t, "a b", mergeOverlap("a b", ""))
+	assert.Equal(t, "c d", mergeOverlap("", "c  d"))
+}
+
+func TestChunkedStitchesInOrder(t *testing.T) {
+	splitter := &fakeSplitter{duration: 65 * time.Second}
+	inner := fakeService(func(_ context.Context, path string) (string, error) {
+		switch path {
+		case "chunk0":
+			time.Sleep(20 * time.Millisecond)
+			return "first part and", nil
+		case "chunk1":
+			return "part and second part", nil
+		default:
+			return "last", nil
+		}
+	})
+	s := NewSTTServiceChunked(zap.NewNop(), inner, splitter, 30*time.Second, 2*time.Second)
+
+	var mu sync.Mutex
+	var progress []int
+	ctx := WithProgress(context.Background(), func(done, total int) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, 3, total)
+		progress = append(progress, done)
+	})
+
+	result, err := s.TransformSpeechToText(ctx, "long.mp3", Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "first part and second part last", result.Text)
+	assert.Equal(t, 65.0, result.Duration)
+	assert.Len(t, splitter.chunks, 3)
+	assert.Equal(t, []int{0, 1, 2, 3}, progress)
+}
+
+func TestChunkedShortAudioAndErrors(t *testing.T) {
+	splitter := &fakeSplitter{duration: 31 * time.Second}
+	inner := fakeService(func(_ context.Context, path string) (string, error) {
+		if path == "chunk1" {
+			return "", errors.New("boom")
+		}
+		return path, nil
+	})
+	s := NewSTTServiceChunked(zap.NewNop(), inner, splitter, 30*time.Second, 2*time.Second)
+
+	result, err := s.TransformSpeechToText(context.Background(), "short.mp3", Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "short.mp3", result.Text)
+	assert.Nil(t, splitter.chunks)
+
+	splitter.duration = time.Minute
+	_, err = s.TransformSpeechToText(context.Background(), "long.mp3", Options{})
+	assert.EqualError(t, err, "boom")
+}
+
+func TestMergeChunkSegments(t *testing.T) {
+	chunks := []Chunk{{Start: 0, Length: 30 * time.Second}, {Start: 26 * time.Second, Length: 30 * time.Second}}
+	results := []Transcription{
+		{Language: "ru", Segments: []Segment{{Start: 0, End: 20, Text: "a"}, {Start: 27, End: 30, Text: "b"}, {Start: 28.5, End: 30, Text: "dup"}}},
+		{Language: "en", Segments: []Segment{{Start: 1, End: 2.5, Text: "b"}, {Start: 2.5, End: 10, Text: "c"}}},
+	}
+
+	merged := mergeChunks(chunks, results, 4*time.Second)
+	assert.Equal(t, "ru", merged.Language)
+	assert.Equal(t, []Segment{
+		{Start: 0, End: 20, Text: "a"},
+		{Start: 27, End: 30, Text: "b"},
+		{Start: 28.5, End: 36, Text: "c"},
+	}, merged.Segments)
+}
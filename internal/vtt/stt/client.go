@@ -2,6 +2,7 @@ package stt
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -17,13 +18,15 @@ import (
 
 type STTClientDefault struct {
 	Logger *zap.Logger
+	Client *http.Client // nil means http.DefaultClient; deadlines come from ctx
 }
 
-func (s STTClientDefault) Request(filePath, url string) (string, error) {
+func (s STTClientDefault) Request(ctx context.Context, filePath, url string, opts Options) (Transcription, error) {
 	startTime := time.Now()
 	log := s.Logger.With(
 		zap.String("worker_url", url),
 		zap.String("file_path", filePath),
+		zap.String("language", opts.Language),
 	)
 
 	log.Info("STT request started")
@@ -31,7 +34,7 @@ func (s STTClientDefault) Request(filePath, url string) (string, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		log.Error("Error opening file", zap.Error(err), zap.String("file path", filePath))
-		return "", fmt.Errorf("error opening file: %v", err)
+		return Transcription{}, fmt.Errorf("error opening file: %v", err)
 	}
 	defer utils.CloserErrorHandle(log, file, "Error closing file")
 
@@ -41,7 +44,7 @@ func (s STTClientDefault) Request(filePath, url string) (string, error) {
 	part, err := writer.CreateFormFile("audio", filepath.Base(filePath))
 	if err != nil {
 		log.Error("Error creating form file", zap.Error(err))
-		return "", fmt.Errorf("error creating form file: %v", err)
+		return Transcription{}, fmt.Errorf("error creating form file: %v", err)
 	}
 
 	bytesCopied, err := io.Copy(part, file)
@@ -49,18 +52,25 @@ func (s STTClientDefault) Request(filePath, url string) (string, error) {
 		log.Error("Error copying file to form",
 			zap.Error(err),
 			zap.Int64("bytes_copied", bytesCopied))
-		return "", fmt.Errorf("error copying file to form: %v", err)
+		return Transcription{}, fmt.Errorf("error copying file to form: %v", err)
+	}
+
+	if opts.Language != "" {
+		if err := writer.WriteField("language", opts.Language); err != nil {
+			log.Error("Error writing language field", zap.Error(err))
+			return Transcription{}, fmt.Errorf("error writing form field language: %v", err)
+		}
 	}
 
 	if err := writer.Close(); err != nil {
 		log.Error("Error closing multipart writer", zap.Error(err))
-		return "", fmt.Errorf("error closing multipart writer: %v", err)
+		return Transcription{}, fmt.Errorf("error closing multipart writer: %v", err)
 	}
 
-	req, err := http.NewRequest("POST", url+"/transcriptions", body)
+	req, err := http.NewRequestWithContext(ctx, "POST", url+"/transcriptions", body)
 	if err != nil {
 		log.Error("Error creating request", zap.Error(err))
-		return "", fmt.Errorf("error creating new request: %v", err)
+		return Transcription{}, fmt.Errorf("error creating new request: %v", err)
 	}
 
 	contentType := writer.FormDataContentType()
@@ -71,12 +81,17 @@ func (s STTClientDefault) Request(filePath, url string) (string, error) {
 		zap.String("content_type", contentType),
 		zap.Int("body_size", body.Len()))
 
-	resp, err := http.DefaultClient.Do(req)
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
 		log.Error("Request failed",
 			zap.Error(err),
 			zap.Duration("elapsed", time.Since(startTime)))
-		return "", fmt.Errorf("error performing request: %v", err)
+		return Transcription{}, fmt.Errorf("error performing request: %w", err)
 	}
 	defer utils.CloserErrorHandle(log, resp.Body, "Error closing response body")
 
@@ -89,7 +104,7 @@ func (s STTClientDefault) Request(filePath, url string) (string, error) {
 		log.Error("Unexpected status code",
 			zap.Int("status_code", resp.StatusCode),
 			zap.String("response_body", string(bodyBytes)))
-		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return Transcription{}, &StatusCodeError{StatusCode: resp.StatusCode}
 	}
 
 	respData, err := io.ReadAll(resp.Body)
@@ -97,7 +112,7 @@ func (s STTClientDefault) Request(filePath, url string) (string, error) {
 		log.Error("Error reading response body",
 			zap.Error(err),
 			zap.Int("response_size", len(respData)))
-		return "", fmt.Errorf("error reading response body: %v", err)
+		return Transcription{}, fmt.Errorf("error reading response body: %w", err)
 	}
 
 	log.Info("Response read",
@@ -108,17 +123,19 @@ func (s STTClientDefault) Request(filePath, url string) (string, error) {
 		log.Error("Error unmarshaling response",
 			zap.Error(err),
 			zap.String("response_sample", utils.Ellipsis(string(respData), 1024)))
-		return "", fmt.Errorf("error unmarshaling response data: %v", err)
+		return Transcription{}, fmt.Errorf("%w: error unmarshaling response data: %v", ErrBadResponse, err)
 	}
 
 	log.Info("STT request completed successfully",
 		zap.String("transcription", utils.Ellipsis(response.Transcription, 1024)),
+		zap.Int("segments", len(response.Segments)),
 		zap.Duration("total_elapsed", time.Since(startTime)))
 
-	return response.Transcription, nil
+	return response.transcription(response.Transcription), nil
 }
 
 // REST API
 type ResponseFromModel struct {
 	Transcription string `json:"transcription"`
+	ModelDetails
 }
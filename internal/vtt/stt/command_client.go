@@ -0,0 +1,169 @@
+package stt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"tg-bot-voice-to-text/pkg/utils"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	FilePlaceholder     = "{file}"
+	LanguagePlaceholder = "{language}" // the language hint, "auto" without one
+)
+
+// STTClientCommand runs a local program (whisper.cpp main, a script, ...)
+// for every request. The worker ID is only used for logging, so one client
+// can serve several local slots. Use NewSTTClientCommand to get a client with
+// a concurrency limit.
+type STTClientCommand struct {
+	Logger *zap.Logger
+
+	Command        []string      // "{file}" is replaced by the audio path, appended if absent; "{language}" by the language
+	OutputFormat   string        // text | json, empty means text
+	ProcessTimeout time.Duration // 0 means the request context deadline only
+
+	slots chan struct{}
+}
+
+func NewSTTClientCommand(logger *zap.Logger, command []string, outputFormat string, processTimeout time.Duration, concurrency int) (*STTClientCommand, error) {
+	if len(command) == 0 {
+		return nil, errors.New("command is required")
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	return &STTClientCommand{
+		Logger:         logger,
+		Command:        command,
+		OutputFormat:   outputFormat,
+		ProcessTimeout: processTimeout,
+		slots:          make(chan struct{}, concurrency),
+	}, nil
+}
+
+func (s *STTClientCommand) Request(ctx context.Context, filePath, workerID string, opts Options) (Transcription, error) {
+	startTime := time.Now()
+	log := s.Logger.With(
+		zap.String("worker_url", workerID),
+		zap.String("file_path", filePath),
+		zap.String("backend", "command"),
+		zap.String("language", opts.Language),
+	)
+
+	if s.slots != nil {
+		select {
+		case s.slots <- struct{}{}:
+			defer func() { <-s.slots }()
+		case <-ctx.Done():
+			return Transcription{}, ctx.Err()
+		}
+	}
+
+	if s.ProcessTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.ProcessTimeout)
+		defer cancel()
+	}
+
+	args := s.args(filePath, opts.Language)
+	log.Info("STT process started", zap.Strings("command", args))
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		log.Error("STT process failed",
+			zap.Error(err),
+			zap.String("stderr", utils.Ellipsis(stderr.String(), 1024)),
+			zap.Duration("elapsed", time.Since(startTime)))
+
+		if ctx.Err() != nil {
+			return Transcription{}, fmt.Errorf("error running command: %w", ctx.Err())
+		}
+
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return Transcription{}, fmt.Errorf("%w: command exited with code %d", ErrBadResponse, exitErr.ExitCode())
+		}
+		return Transcription{}, fmt.Errorf("error running command: %v", err)
+	}
+
+	result, err := s.parseOutput(stdout.Bytes())
+	if err != nil {
+		log.Error("Error parsing command output",
+			zap.Error(err),
+			zap.String("output_sample", utils.Ellipsis(stdout.String(), 1024)))
+		return Transcription{}, err
+	}
+
+	log.Info("STT process completed successfully",
+		zap.String("transcription", utils.Ellipsis(result.Text, 1024)),
+		zap.Int("segments", len(result.Segments)),
+		zap.Duration("total_elapsed", time.Since(startTime)))
+
+	return result, nil
+}
+
+// Probe checks that the configured program can be found.
+func (s *STTClientCommand) Probe(context.Context, string) error {
+	_, err := exec.LookPath(s.Command[0])
+	return err
+}
+
+func (s *STTClientCommand) args(filePath, language string) []string {
+	args := make([]string, 0, len(s.Command)+1)
+	replaced := false
+	if language == "" {
+		language = "auto"
+	}
+
+	for _, arg := range s.Command {
+		arg = strings.ReplaceAll(arg, LanguagePlaceholder, language)
+		if strings.Contains(arg, FilePlaceholder) {
+			arg = strings.ReplaceAll(arg, FilePlaceholder, filePath)
+			replaced = true
+		}
+		args = append(args, arg)
+	}
+
+	if !replaced {
+		args = append(args, filePath)
+	}
+	return args
+}
+
+func (s *STTClientCommand) parseOutput(out []byte) (Transcription, error) {
+	if s.OutputFormat != "json" {
+		return TextTranscription(string(out)), nil
+	}
+
+	var response struct {
+		Text          *string `json:"text"`
+		Transcription *string `json:"transcription"`
+		ModelDetails
+	}
+	if err := json.Unmarshal(out, &response); err != nil {
+		return Transcription{}, fmt.Errorf("%w: error unmarshaling command output: %v", ErrBadResponse, err)
+	}
+
+	switch {
+	case response.Text != nil:
+		return response.transcription(*response.Text), nil
+	case response.Transcription != nil:
+		return response.transcription(*response.Transcription), nil
+	default:
+		return Transcription{}, fmt.Errorf("%w: no text or transcription field in command output", ErrBadResponse)
+	}
+}
@@ -0,0 +1,67 @@
+package stt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestCommandClientOutput(t *testing.T) {
+	client, err := NewSTTClientCommand(zap.NewNop(), []string{"sh", "-c", "echo ' hello '; test -f {file}"}, "text", time.Second, 1)
+	require.NoError(t, err)
+
+	result, err := client.Request(context.Background(), writeTempAudio(t), "local", Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "hello", result.Text)
+
+	client.Command = []string{"sh", "-c", `echo '{"text": "from json"}' # {file}`}
+	client.OutputFormat = "json"
+	result, err = client.Request(context.Background(), writeTempAudio(t), "local", Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "from json", result.Text)
+}
+
+func TestCommandClientLanguagePlaceholder(t *testing.T) {
+	client, err := NewSTTClientCommand(zap.NewNop(), []string{"sh", "-c", "echo {language}", "{file}"}, "text", time.Second, 1)
+	require.NoError(t, err)
+
+	result, err := client.Request(context.Background(), writeTempAudio(t), "local", Options{Language: "kk"})
+	require.NoError(t, err)
+	assert.Equal(t, "kk", result.Text)
+
+	result, err = client.Request(context.Background(), writeTempAudio(t), "local", Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "auto", result.Text)
+}
+
+func TestCommandClientFailures(t *testing.T) {
+	client, err := NewSTTClientCommand(zap.NewNop(), []string{"sh", "-c", "exit 3"}, "text", 50*time.Millisecond, 1)
+	require.NoError(t, err)
+
+	_, err = client.Request(context.Background(), writeTempAudio(t), "local", Options{})
+	assert.ErrorIs(t, err, ErrBadResponse)
+
+	client.Command = []string{"sh", "-c", "sleep 5 # {file}"}
+	start := time.Now()
+	_, err = client.Request(context.Background(), writeTempAudio(t), "local", Options{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.True(t, IsRetryable(err))
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestCommandClientConcurrencyLimit(t *testing.T) {
+	client, err := NewSTTClientCommand(zap.NewNop(), []string{"sh", "-c", "sleep 1 # {file}"}, "text", 0, 1)
+	require.NoError(t, err)
+
+	go func() { _, _ = client.Request(context.Background(), "", "local#0", Options{}) }()
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = client.Request(ctx, "", "local#1", Options{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "second request must wait for the only slot")
+}
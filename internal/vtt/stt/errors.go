@@ -0,0 +1,57 @@
+package stt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+)
+
+var (
+	ErrBadResponse        = errors.New("bad response from model instance")
+	ErrServiceUnavailable = errors.New("no model instance is available")
+	ErrInstanceBusy       = errors.New("model instance is recovering, its trial request is in flight")
+)
+
+type StatusCodeError struct {
+	StatusCode int
+}
+
+func (e *StatusCodeError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+}
+
+// IsRetryable reports whether a failed request may succeed on another attempt,
+// possibly on another model instance. Cancellation of the caller's context is
+// never retryable; the caller is expected to check its own context first.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var statusErr *StatusCodeError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 ||
+			statusErr.StatusCode == http.StatusTooManyRequests ||
+			statusErr.StatusCode == http.StatusRequestTimeout
+	}
+
+	if errors.Is(err, ErrBadResponse) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+
+	// *url.Error is a net.Error itself, whatever it wraps: an unsupported
+	// scheme or a malformed URL fails the same way on every attempt
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
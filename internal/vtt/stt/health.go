@@ -0,0 +1,35 @@
+package stt
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"tg-bot-voice-to-text/pkg/health"
+)
+
+// HTTPHealthProbe checks a model instance with GET url+endpoint, any 2xx
+// response means the instance is healthy.
+func HTTPHealthProbe(client *http.Client, endpoint string) health.ProbeFunc {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return func(ctx context.Context, url string) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+endpoint, nil)
+		if err != nil {
+			return fmt.Errorf("error creating health request: %v", err)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("error performing health request: %w", err)
+		}
+		_ = resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return &StatusCodeError{StatusCode: resp.StatusCode}
+		}
+		return nil
+	}
+}
@@ -1,9 +1,35 @@
 package stt
 
+import (
+	"context"
+	"fmt"
+)
+
+// Options of one transcription, passed down to the backend.
+type Options struct {
+	Language string // ISO 639-1 code of the speech, empty lets the backend detect it
+}
+
 type STTClient interface {
-	Request(filePath, url string) (string, error)
+	Request(ctx context.Context, filePath, url string, opts Options) (Transcription, error)
 }
 
 type STTService interface {
-	TransformSpeechToText(voiceFilepath string) (string, error)
+	TransformSpeechToText(ctx context.Context, voiceFilepath string, opts Options) (Transcription, error)
+}
+
+type WorkerAvailability interface {
+	Available(workerURL string) bool
+}
+
+// STTClientByWorker routes each request to the client of its worker URL,
+// so instances speaking different protocols can share one scheduler.
+type STTClientByWorker map[string]STTClient
+
+func (c STTClientByWorker) Request(ctx context.Context, filePath, url string, opts Options) (Transcription, error) {
+	client, ok := c[url]
+	if !ok {
+		return Transcription{}, fmt.Errorf("no STT client for worker %s", url)
+	}
+	return client.Request(ctx, filePath, url, opts)
 }
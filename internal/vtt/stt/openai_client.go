@@ -0,0 +1,188 @@
+package stt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"tg-bot-voice-to-text/pkg/utils"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type OpenAIOptions struct {
+	Model          string
+	Language       string
+	Prompt         string
+	Temperature    *float64 // nil leaves it to the server
+	ResponseFormat string   // json | verbose_json | text, empty means json
+	APIKey         string
+}
+
+// IsOpenAIResponseFormat reports whether the client can parse the response
+// format into a transcription; subtitle formats such as srt are not.
+func IsOpenAIResponseFormat(format string) bool {
+	switch format {
+	case "", "json", "verbose_json", "text":
+		return true
+	}
+	return false
+}
+
+// STTClientOpenAI speaks the OpenAI audio API: url is the API base
+// (for example "http://localhost:8000/v1"), the request goes to
+// url+"/audio/transcriptions".
+type STTClientOpenAI struct {
+	Logger  *zap.Logger
+	Client  *http.Client // nil means http.DefaultClient; deadlines come from ctx
+	Options OpenAIOptions
+}
+
+func (s STTClientOpenAI) Request(ctx context.Context, filePath, url string, opts Options) (Transcription, error) {
+	startTime := time.Now()
+	log := s.Logger.With(
+		zap.String("worker_url", url),
+		zap.String("file_path", filePath),
+		zap.String("backend", "openai"),
+	)
+	log.Info("STT request started")
+
+	body, contentType, err := s.newRequestBody(filePath, opts)
+	if err != nil {
+		log.Error("Error building request body", zap.Error(err))
+		return Transcription{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(url, "/")+"/audio/transcriptions", body)
+	if err != nil {
+		log.Error("Error creating request", zap.Error(err))
+		return Transcription{}, fmt.Errorf("error creating new request: %v", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if s.Options.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Options.APIKey)
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Error("Request failed",
+			zap.Error(err),
+			zap.Duration("elapsed", time.Since(startTime)))
+		return Transcription{}, fmt.Errorf("error performing request: %w", err)
+	}
+	defer utils.CloserErrorHandle(log, resp.Body, "Error closing response body")
+
+	log.Info("Response received",
+		zap.String("status", resp.Status),
+		zap.Duration("elapsed", time.Since(startTime)))
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		log.Error("Unexpected status code",
+			zap.Int("status_code", resp.StatusCode),
+			zap.String("response_body", string(bodyBytes)))
+		return Transcription{}, &StatusCodeError{StatusCode: resp.StatusCode}
+	}
+
+	respData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Error("Error reading response body", zap.Error(err))
+		return Transcription{}, fmt.Errorf("error reading response body: %w", err)
+	}
+
+	result, err := s.parseResponse(respData)
+	if err != nil {
+		log.Error("Error unmarshaling response",
+			zap.Error(err),
+			zap.String("response_sample", utils.Ellipsis(string(respData), 1024)))
+		return Transcription{}, err
+	}
+
+	log.Info("STT request completed successfully",
+		zap.String("transcription", utils.Ellipsis(result.Text, 1024)),
+		zap.Int("segments", len(result.Segments)),
+		zap.Duration("total_elapsed", time.Since(startTime)))
+
+	return result, nil
+}
+
+func (s STTClientOpenAI) newRequestBody(filePath string, opts Options) (*bytes.Buffer, string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, "", fmt.Errorf("error opening file: %v", err)
+	}
+	defer utils.CloserErrorHandle(s.Logger, file, "Error closing file")
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	part, err := writer.CreateFormFile("file", filepath.Base(filePath))
+	if err != nil {
+		return nil, "", fmt.Errorf("error creating form file: %v", err)
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return nil, "", fmt.Errorf("error copying file to form: %v", err)
+	}
+
+	language := s.Options.Language
+	if opts.Language != "" {
+		language = opts.Language
+	}
+
+	fields := [][2]string{
+		{"model", s.Options.Model},
+		{"language", language},
+		{"prompt", s.Options.Prompt},
+		{"response_format", s.Options.ResponseFormat},
+	}
+	if s.Options.Temperature != nil {
+		fields = append(fields, [2]string{"temperature", strconv.FormatFloat(*s.Options.Temperature, 'f', -1, 64)})
+	}
+
+	for _, field := range fields {
+		if field[1] == "" {
+			continue
+		}
+		if err := writer.WriteField(field[0], field[1]); err != nil {
+			return nil, "", fmt.Errorf("error writing form field %s: %v", field[0], err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, "", fmt.Errorf("error closing multipart writer: %v", err)
+	}
+
+	return body, writer.FormDataContentType(), nil
+}
+
+func (s STTClientOpenAI) parseResponse(data []byte) (Transcription, error) {
+	if s.Options.ResponseFormat == "text" {
+		return TextTranscription(string(data)), nil
+	}
+
+	var response OpenAIResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return Transcription{}, fmt.Errorf("%w: error unmarshaling response data: %v", ErrBadResponse, err)
+	}
+
+	return response.transcription(response.Text), nil
+}
+
+// REST API (json and verbose_json response formats)
+type OpenAIResponse struct {
+	Text string `json:"text"`
+	ModelDetails
+}
@@ -0,0 +1,176 @@
+package stt
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func writeTempAudio(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "voice.mp3")
+	require.NoError(t, os.WriteFile(path, []byte("audio"), 0644))
+	return path
+}
+
+func TestOpenAIClientRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/audio/transcriptions", r.URL.Path)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+
+		require.NoError(t, r.ParseMultipartForm(1<<20))
+		assert.Equal(t, "whisper-1", r.FormValue("model"))
+		assert.Equal(t, "ru", r.FormValue("language"))
+		assert.Equal(t, "0.2", r.FormValue("temperature"))
+		assert.Empty(t, r.FormValue("prompt"))
+
+		file, _, err := r.FormFile("file")
+		require.NoError(t, err)
+		data, _ := io.ReadAll(file)
+		assert.Equal(t, "audio", string(data))
+
+		_, _ = w.Write([]byte(`{"text": " привет "}`))
+	}))
+	defer server.Close()
+
+	temperature := 0.2
+	client := STTClientOpenAI{
+		Logger: zap.NewNop(),
+		Options: OpenAIOptions{
+			Model:       "whisper-1",
+			Language:    "ru",
+			Temperature: &temperature,
+			APIKey:      "secret",
+		},
+	}
+
+	result, err := client.Request(context.Background(), writeTempAudio(t), server.URL+"/v1", Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "привет", result.Text)
+}
+
+func TestOpenAIClientTextFormatAndErrors(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("plain text\n"))
+	}))
+	defer server.Close()
+
+	client := STTClientOpenAI{Logger: zap.NewNop(), Options: OpenAIOptions{ResponseFormat: "text"}}
+	result, err := client.Request(context.Background(), writeTempAudio(t), server.URL, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "plain text", result.Text)
+
+	client.Options.ResponseFormat = "json"
+	_, err = client.Request(context.Background(), writeTempAudio(t), server.URL, Options{})
+	assert.ErrorIs(t, err, ErrBadResponse)
+
+	status = http.StatusBadGateway
+	_, err = client.Request(context.Background(), writeTempAudio(t), server.URL, Options{})
+	assert.True(t, IsRetryable(err))
+}
+
+func TestOpenAIClientVerboseJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{
+			"text": "one two",
+			"language": "english",
+			"duration": 3.5,
+			"segments": [
+				{"start": 0, "end": 1.5, "text": " one", "avg_logprob": 0},
+				{"start": 1.5, "end": 3.5, "text": " two"}
+			]
+		}`))
+	}))
+	defer server.Close()
+
+	client := STTClientOpenAI{Logger: zap.NewNop(), Options: OpenAIOptions{ResponseFormat: "verbose_json"}}
+	result, err := client.Request(context.Background(), writeTempAudio(t), server.URL, Options{})
+	require.NoError(t, err)
+
+	assert.Equal(t, "english", result.Language)
+	assert.Equal(t, 3.5, result.Duration)
+	require.Len(t, result.Segments, 2)
+	assert.Equal(t, "one", result.Segments[0].Text)
+	require.NotNil(t, result.Segments[0].Confidence)
+	assert.Equal(t, 1.0, *result.Segments[0].Confidence)
+	assert.Nil(t, result.Segments[1].Confidence)
+}
+
+func TestOpenAIClientLanguageHint(t *testing.T) {
+	var languages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseMultipartForm(1<<20))
+		languages = append(languages, r.FormValue("language"))
+		_, _ = w.Write([]byte(`{"text": "ok"}`))
+	}))
+	defer server.Close()
+
+	client := STTClientOpenAI{Logger: zap.NewNop(), Options: OpenAIOptions{Language: "ru"}}
+	_, err := client.Request(context.Background(), writeTempAudio(t), server.URL, Options{Language: "kk"})
+	require.NoError(t, err)
+	_, err = client.Request(context.Background(), writeTempAudio(t), server.URL, Options{})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"kk", "ru"}, languages, "the hint overrides the configured language")
+}
+
+func TestDefaultClientLanguageHint(t *testing.T) {
+	var languages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/transcriptions", r.URL.Path)
+		require.NoError(t, r.ParseMultipartForm(1<<20))
+		languages = append(languages, r.FormValue("language"))
+		_, _ = w.Write([]byte(`{"transcription": "ok"}`))
+	}))
+	defer server.Close()
+
+	client := STTClientDefault{Logger: zap.NewNop()}
+	result, err := client.Request(context.Background(), writeTempAudio(t), server.URL, Options{Language: "en"})
+	require.NoError(t, err)
+	assert.Equal(t, "ok", result.Text)
+	_, err = client.Request(context.Background(), writeTempAudio(t), server.URL, Options{})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"en", ""}, languages)
+}
+
+func TestOpenAIClientTemperature(t *testing.T) {
+	var temperatures []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseMultipartForm(1<<20))
+		_, set := r.MultipartForm.Value["temperature"]
+		temperatures = append(temperatures, fmt.Sprintf("%s %v", r.FormValue("temperature"), set))
+		_, _ = w.Write([]byte(`{"text": "ok"}`))
+	}))
+	defer server.Close()
+
+	zero := 0.0
+	client := STTClientOpenAI{Logger: zap.NewNop(), Options: OpenAIOptions{Temperature: &zero}}
+	_, err := client.Request(context.Background(), writeTempAudio(t), server.URL, Options{})
+	require.NoError(t, err)
+
+	client.Options.Temperature = nil
+	_, err = client.Request(context.Background(), writeTempAudio(t), server.URL, Options{})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"0 true", " false"}, temperatures, "zero is sent, unset is omitted")
+}
+
+func TestIsOpenAIResponseFormat(t *testing.T) {
+	for _, format := range []string{"", "json", "verbose_json", "text"} {
+		assert.True(t, IsOpenAIResponseFormat(format), format)
+	}
+	for _, format := range []string{"srt", "vtt", "xml"} {
+		assert.False(t, IsOpenAIResponseFormat(format), format)
+	}
+}
@@ -0,0 +1,18 @@
+package stt
+
+import "context"
+
+// ProgressFunc is called when a part of a long transcription is done.
+type ProgressFunc func(done, total int)
+
+type progressKey struct{}
+
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+func reportProgress(ctx context.Context, done, total int) {
+	if fn, ok := ctx.Value(progressKey{}).(ProgressFunc); ok && fn != nil {
+		fn(done, total)
+	}
+}
@@ -0,0 +1,86 @@
+package stt
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+)
+
+type Segment struct {
+	Start      float64  `json:"start"` // seconds
+	End        float64  `json:"end"`   // seconds
+	Text       string   `json:"text"`
+	Confidence *float64 `json:"confidence,omitempty"` // 0..1
+}
+
+type Transcription struct {
+	Text     string    `json:"text"`
+	Language string    `json:"language,omitempty"`
+	Duration float64   `json:"duration,omitempty"` // seconds
+	Segments []Segment `json:"segments,omitempty"`
+}
+
+func TextTranscription(text string) Transcription {
+	return Transcription{Text: strings.TrimSpace(text)}
+}
+
+// ModelDetails are the optional fields Whisper-like servers return next to
+// the text (OpenAI verbose_json, faster-whisper, whisper.cpp JSON output).
+type ModelDetails struct {
+	Language string             `json:"language,omitempty"`
+	Duration float64            `json:"duration,omitempty"`
+	Segments []SegmentFromModel `json:"segments,omitempty"`
+}
+
+type SegmentFromModel struct {
+	Start      float64  `json:"start"`
+	End        float64  `json:"end"`
+	Text       string   `json:"text"`
+	AvgLogprob *float64 `json:"avg_logprob,omitempty"`
+	Confidence *float64 `json:"confidence,omitempty"`
+}
+
+func (d ModelDetails) transcription(text string) Transcription {
+	t := TextTranscription(text)
+	t.Language = d.Language
+	t.Duration = d.Duration
+
+	for _, s := range d.Segments {
+		segment := Segment{Start: s.Start, End: s.End, Text: strings.TrimSpace(s.Text)}
+
+		switch {
+		case s.Confidence != nil:
+			segment.Confidence = s.Confidence
+		case s.AvgLogprob != nil:
+			confidence := math.Exp(*s.AvgLogprob)
+			segment.Confidence = &confidence
+		}
+
+		t.Segments = append(t.Segments, segment)
+	}
+
+	if t.Duration == 0 && len(t.Segments) > 0 {
+		t.Duration = t.Segments[len(t.Segments)-1].End
+	}
+
+	return t
+}
+
+// EncodeTranscription serializes t for string caches.
+func EncodeTranscription(t Transcription) string {
+	data, err := json.Marshal(t)
+	if err != nil { // can not happen for this type
+		return t.Text
+	}
+	return string(data)
+}
+
+// DecodeTranscription reverses EncodeTranscription. Values that are not
+// JSON, like entries cached before results had structure, are plain text.
+func DecodeTranscription(value string) Transcription {
+	var t Transcription
+	if !strings.HasPrefix(value, "{") || json.Unmarshal([]byte(value), &t) != nil {
+		return TextTranscription(value)
+	}
+	return t
+}
@@ -0,0 +1,105 @@
+package stt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Chunk struct {
+	Start  time.Duration
+	Length time.Duration
+}
+
+type AudioSplitter interface {
+	Duration(ctx context.Context, filePath string) (time.Duration, error)
+	// Split writes one file per chunk and returns their paths in chunk order.
+	Split(ctx context.Context, filePath string, chunks []Chunk) ([]string, error)
+}
+
+// FFmpegSplitter cuts audio with ffmpeg into 16 kHz mono wav files,
+// which every Whisper backend accepts.
+type FFmpegSplitter struct {
+	FFmpegPath  string
+	FFprobePath string
+}
+
+func (f FFmpegSplitter) Duration(ctx context.Context, filePath string) (time.Duration, error) {
+	out, err := run(ctx, orDefault(f.FFprobePath, "ffprobe"),
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		filePath,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error probing audio duration: %v", err)
+	}
+
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(out), 64)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing audio duration %q: %v", out, err)
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+func (f FFmpegSplitter) Split(ctx context.Context, filePath string, chunks []Chunk) ([]string, error) {
+	ext := filepath.Ext(filePath)
+	base := strings.TrimSuffix(filePath, ext)
+
+	paths := make([]string, 0, len(chunks))
+	for i, chunk := range chunks {
+		chunkPath := fmt.Sprintf("%s_chunk%03d.wav", base, i)
+
+		if _, err := run(ctx, orDefault(f.FFmpegPath, "ffmpeg"),
+			"-hide_banner", "-loglevel", "error", "-y",
+			"-ss", formatSeconds(chunk.Start),
+			"-t", formatSeconds(chunk.Length),
+			"-i", filePath,
+			"-vn", "-ac", "1", "-ar", "16000",
+			chunkPath,
+		); err != nil {
+			RemoveFiles(paths)
+			return nil, fmt.Errorf("error cutting chunk %d: %v", i, err)
+		}
+
+		paths = append(paths, chunkPath)
+	}
+
+	return paths, nil
+}
+
+func RemoveFiles(paths []string) {
+	for _, path := range paths {
+		_ = os.Remove(path)
+	}
+}
+
+func run(ctx context.Context, name string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %v: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,52 @@
+package stt
+
+import (
+	"context"
+	"time"
+
+	"tg-bot-voice-to-text/pkg/breaker"
+)
+
+// STTClientWithBreaker feeds the outcome of every request into the circuit
+// breaker of its worker URL. Only instance failures (see IsRetryable) count
+// as errors; a canceled caller is not recorded at all. A request the breaker
+// does not allow, while its half-open trial call is in flight, fails with
+// ErrInstanceBusy without reaching the instance.
+type STTClientWithBreaker struct {
+	Client   STTClient
+	Breakers *breaker.Set
+}
+
+func (c STTClientWithBreaker) Request(ctx context.Context, filePath, url string, opts Options) (Transcription, error) {
+	if !c.Breakers.Allow(url) {
+		return Transcription{}, ErrInstanceBusy
+	}
+
+	start := time.Now()
+	result, err := c.Client.Request(ctx, filePath, url, opts)
+
+	if ctx.Err() == nil || IsRetryable(err) {
+		c.Breakers.Record(url, IsRetryable(err), time.Since(start))
+	} else {
+		c.Breakers.Release(url)
+	}
+
+	return result, err
+}
+
+type allAvailable []WorkerAvailability
+
+// AllAvailable combines availabilities: a worker is available only if every
+// one of them says so.
+func AllAvailable(availabilities ...WorkerAvailability) WorkerAvailability {
+	return allAvailable(availabilities)
+}
+
+func (a allAvailable) Available(workerURL string) bool {
+	for _, availability := range a {
+		if !availability.Available(workerURL) {
+			return false
+		}
+	}
+	return true
+}
@@ -1,6 +1,8 @@
 package stt
 
 import (
+	"context"
+	"errors"
 	"tg-bot-voice-to-text/pkg/scheduler"
 	"tg-bot-voice-to-text/pkg/utils"
 	"time"
@@ -10,60 +12,177 @@ import (
 
 type STTServiceWithScheduler struct {
 	logger *zap.Logger
-	sched  scheduler.NamedWorkerScheduler[string]
-	client STTClient
+
+	sched          scheduler.NamedWorkerScheduler[string]
+	client         STTClient
+	workers        []string
+	availability   WorkerAvailability
+	requestTimeout time.Duration
+	retry          RetryPolicy
 }
 
-func NewSTTServiceWithScheduler(logger *zap.Logger, client STTClient, sched scheduler.NamedWorkerScheduler[string], instancesURL []string) STTServiceWithScheduler {
+// availability may be nil, then every worker is considered available.
+func NewSTTServiceWithScheduler(logger *zap.Logger, client STTClient, sched scheduler.NamedWorkerScheduler[string], instancesURL []string, availability WorkerAvailability, requestTimeout time.Duration, retry RetryPolicy) STTServiceWithScheduler {
 	logger.Info("Initializing STT service with scheduler",
 		zap.Int("worker_count", len(instancesURL)),
-		zap.Strings("worker_urls", instancesURL))
+		zap.Strings("worker_urls", instancesURL),
+		zap.Duration("request_timeout", requestTimeout),
+		zap.Int("max_attempts", retry.attempts()),
+		zap.Duration("retry_base_delay", retry.BaseDelay),
+		zap.Duration("retry_max_delay", retry.MaxDelay))
 
 	s := STTServiceWithScheduler{
-		logger: logger,
-		sched:  sched,
-		client: client,
+		logger:         logger,
+		sched:          sched,
+		client:         client,
+		workers:        instancesURL,
+		availability:   availability,
+		requestTimeout: requestTimeout,
+		retry:          retry,
 	}
+
 	s.sched.Start(instancesURL)
+
 	return s
 }
 
-func (s STTServiceWithScheduler) TransformSpeechToText(filePath string) (string, error) {
-	log := s.logger.With(zap.String("file_path", filePath))
-	log.Info("Starting speech-to-text transformation")
+type sttResult struct {
+	result    Transcription
+	err       error
+	workerURL string
+	deferred  bool // picked up by an avoided worker, not run
+}
 
-	resultChan := make(chan string, 1)
-	errChan := make(chan error, 1)
+func (s STTServiceWithScheduler) TransformSpeechToText(ctx context.Context, filePath string, opts Options) (Transcription, error) {
+	log := s.logger.With(zap.String("file_path", filePath), zap.String("language", opts.Language))
+	log.Info("Starting speech-to-text transformation")
 
 	startTime := time.Now()
-	log.Info("Scheduling STT task")
+	failed := make(map[string]bool)
+
+	var res sttResult
+	for attempt := 1; attempt <= s.retry.attempts(); attempt++ {
+		if attempt > 1 {
+			delay := s.retry.backoff(attempt - 1)
+			log.Info("Retrying STT task", zap.Int("attempt", attempt), zap.Duration("delay", delay))
+			if err := sleepCtx(ctx, delay); err != nil {
+				return Transcription{}, err
+			}
+		}
+
+		if !s.anyAvailable() {
+			log.Warn("No available model instances", zap.Int("attempt", attempt))
+			return Transcription{}, ErrServiceUnavailable
+		}
+
+		if len(failed) >= len(s.workers) { // every worker failed once, allow all of them again
+			clear(failed)
+			failed[res.workerURL] = true
+		}
+
+		var err error
+		res, err = s.requestOnce(ctx, filePath, opts, failed)
+		if err != nil {
+			log.Warn("Speech-to-text transformation aborted",
+				zap.Error(err),
+				zap.Int("attempt", attempt),
+				zap.Duration("total_time", time.Since(startTime)))
+			return Transcription{}, err
+		}
+
+		if res.err == nil {
+			log.Info("Speech-to-text transformation succeeded",
+				zap.String("worker url", res.workerURL),
+				zap.Int("attempt", attempt),
+				zap.String("result_sample", utils.Ellipsis(res.result.Text, 1024)),
+				zap.Duration("total_time", time.Since(startTime)))
+			return res.result, nil
+		}
+
+		retryable := ctx.Err() == nil && IsRetryable(res.err)
+		log.Warn("STT attempt failed",
+			zap.Error(res.err),
+			zap.String("worker url", res.workerURL),
+			zap.Int("attempt", attempt),
+			zap.Bool("retryable", retryable))
+		if !retryable {
+			break
+		}
 
-	var workerURL string
-	done := s.sched.Schedule(func(url string) {
-		workerURL = url
+		failed[res.workerURL] = true
+	}
+
+	log.Error("Speech-to-text transformation failed",
+		zap.Error(res.err),
+		zap.String("worker url", res.workerURL),
+		zap.Duration("total_time", time.Since(startTime)))
+
+	return Transcription{}, res.err
+}
+
+// requestOnce runs a single request on some worker, preferring workers not in
+// avoid. A task picked up by an avoided worker is handed back and scheduled
+// again from here, at most once per worker, so it still runs if only avoided
+// workers are free; a worker never pushes into the queue it drains. A task
+// that lost the half-open trial call of its worker to another one
+// (ErrInstanceBusy) is scheduled again as well, the gate then hides the
+// worker until the trial call ends.
+// The returned error is non-nil only if ctx is done.
+func (s STTServiceWithScheduler) requestOnce(ctx context.Context, filePath string, opts Options, avoid map[string]bool) (sttResult, error) {
+	resultChan := make(chan sttResult, 1)
+
+	deferrals := 0
+	for {
+		deferrable := deferrals < len(s.workers)
+		s.sched.Schedule(ctx, func(url string) {
+			if deferrable && avoid[url] {
+				resultChan <- sttResult{workerURL: url, deferred: true}
+				return
+			}
 
-		result, err := s.client.Request(filePath, url)
+			reqCtx, cancel := s.withRequestTimeout(ctx)
+			defer cancel()
 
-		resultChan <- result
-		errChan <- err
-	})
+			s.logger.Info("STT attempt started",
+				zap.String("file_path", filePath),
+				zap.String("worker url", url))
 
-	<-done
+			result, err := s.client.Request(reqCtx, filePath, url, opts)
+			resultChan <- sttResult{result: result, err: err, workerURL: url}
+		})
 
-	result := <-resultChan
-	errResult := <-errChan
+		select {
+		case res := <-resultChan:
+			if res.deferred {
+				deferrals++
+				continue
+			}
+			if errors.Is(res.err, ErrInstanceBusy) {
+				continue
+			}
+			return res, nil
+		case <-ctx.Done():
+			return sttResult{}, ctx.Err()
+		}
+	}
+}
+
+func (s STTServiceWithScheduler) anyAvailable() bool {
+	if s.availability == nil {
+		return len(s.workers) > 0
+	}
 
-	if errResult != nil {
-		log.Error("Speech-to-text transformation failed",
-			zap.Error(errResult),
-			zap.String("worker url", workerURL),
-			zap.Duration("total_time", time.Since(startTime)))
-	} else {
-		log.Info("Speech-to-text transformation succeeded",
-			zap.String("worker url", workerURL),
-			zap.String("result_sample", utils.Ellipsis(result, 1024)),
-			zap.Duration("total_time", time.Since(startTime)))
+	for _, url := range s.workers {
+		if s.availability.Available(url) {
+			return true
+		}
 	}
+	return false
+}
 
-	return result, errResult
+func (s STTServiceWithScheduler) withRequestTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.requestTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.requestTimeout)
 }
@@ -0,0 +1,160 @@
+package stt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"tg-bot-voice-to-text/pkg/queue"
+	"tg-bot-voice-to-text/pkg/scheduler"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type fakeClient struct {
+	mu    sync.Mutex
+	calls []string
+	fn    func(url string) (string, error)
+}
+
+func (f *fakeClient) Request(_ context.Context, _, url string, _ Options) (Transcription, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, url)
+	f.mu.Unlock()
+
+	text, err := f.fn(url)
+	return TextTranscription(text), err
+}
+
+func newTestService(t *testing.T, client STTClient, workers []string, retry RetryPolicy) STTServiceWithScheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	sched := scheduler.NewNamedWorkerSchedulerQueue[string](ctx, queue.BoundedQueue[func(string)]{Queue: make(chan func(string), 100)})
+	return NewSTTServiceWithScheduler(zap.NewNop(), client, sched, workers, nil, time.Second, retry)
+}
+
+func TestRetryFailsOverToAnotherWorker(t *testing.T) {
+	client := &fakeClient{fn: func(url string) (string, error) {
+		if url == "bad" {
+			return "", &StatusCodeError{StatusCode: 503}
+		}
+		return "hello", nil
+	}}
+	s := newTestService(t, client, []string{"bad", "good"}, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+
+	result, err := s.TransformSpeechToText(context.Background(), "file", Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "hello", result.Text)
+	assert.LessOrEqual(t, len(client.calls), 2)
+}
+
+func TestRetryStopsOnNonRetryableError(t *testing.T) {
+	client := &fakeClient{fn: func(string) (string, error) {
+		return "", &StatusCodeError{StatusCode: 400}
+	}}
+	s := newTestService(t, client, []string{"a", "b"}, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+
+	_, err := s.TransformSpeechToText(context.Background(), "file", Options{})
+	require.Error(t, err)
+	assert.Len(t, client.calls, 1)
+}
+
+func TestRetryBudget(t *testing.T) {
+	client := &fakeClient{fn: func(string) (string, error) {
+		return "", ErrBadResponse
+	}}
+	s := newTestService(t, client, []string{"a", "b"}, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+
+	_, err := s.TransformSpeechToText(context.Background(), "file", Options{})
+	assert.True(t, errors.Is(err, ErrBadResponse))
+	assert.Len(t, client.calls, 3)
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, IsRetryable(&StatusCodeError{StatusCode: 502}))
+	assert.True(t, IsRetryable(&StatusCodeError{StatusCode: 429}))
+	assert.False(t, IsRetryable(&StatusCodeError{StatusCode: 404}))
+	assert.True(t, IsRetryable(context.DeadlineExceeded))
+	assert.False(t, IsRetryable(context.Canceled))
+	assert.False(t, IsRetryable(errors.New("error opening file")))
+
+	refused := &url.Error{Op: "Post", URL: "http://a", Err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}
+	assert.True(t, IsRetryable(refused))
+	assert.True(t, IsRetryable(fmt.Errorf("error in request: %w", syscall.ECONNRESET)))
+	assert.False(t, IsRetryable(&url.Error{Op: "Post", URL: "ftp://a", Err: errors.New(`unsupported protocol scheme "ftp"`)}))
+	_, err := http.NewRequest(http.MethodPost, "http://a b", nil)
+	assert.False(t, IsRetryable(err), "malformed URL")
+}
+
+func TestInstanceBusyDoesNotTakeAnAttempt(t *testing.T) {
+	busy := 2
+	client := &fakeClient{fn: func(string) (string, error) {
+		if busy > 0 {
+			busy--
+			return "", ErrInstanceBusy
+		}
+		return "hello", nil
+	}}
+	s := newTestService(t, client, []string{"a"}, RetryPolicy{MaxAttempts: 1})
+
+	result, err := s.TransformSpeechToText(context.Background(), "file", Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "hello", result.Text)
+	assert.Len(t, client.calls, 3)
+}
+
+// orderedScheduler hands the tasks to the workers in the given order from a
+// single goroutine reading an unbuffered channel. Like a full bounded queue,
+// a task scheduling another one from its worker would block forever.
+type orderedScheduler struct {
+	tasks chan func(string)
+	order []string
+}
+
+func (s *orderedScheduler) Start([]string) {
+	go func() {
+		for i := 0; ; i++ {
+			task, ok := <-s.tasks
+			if !ok {
+				return
+			}
+			task(s.order[min(i, len(s.order)-1)])
+		}
+	}()
+}
+
+func (s *orderedScheduler) Schedule(ctx context.Context, task func(string)) chan struct{} {
+	s.tasks <- task
+	return nil
+}
+
+func (s *orderedScheduler) Stop() { close(s.tasks) }
+
+func TestAvoidedWorkerDoesNotScheduleFromWorker(t *testing.T) {
+	client := &fakeClient{fn: func(url string) (string, error) {
+		if url == "a" {
+			return "", &StatusCodeError{StatusCode: 503}
+		}
+		return "hello", nil
+	}}
+	sched := &orderedScheduler{tasks: make(chan func(string)), order: []string{"a", "a", "b"}}
+	s := NewSTTServiceWithScheduler(zap.NewNop(), client, sched, []string{"a", "b"}, nil, time.Second, RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond})
+	t.Cleanup(sched.Stop)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	result, err := s.TransformSpeechToText(ctx, "file", Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "hello", result.Text)
+	assert.Equal(t, []string{"a", "b"}, client.calls, "the second task picked up by a is handed to b")
+}
@@ -0,0 +1,91 @@
+package vtt
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"tg-bot-voice-to-text/internal/vtt/stt"
+	"tg-bot-voice-to-text/pkg/health"
+)
+
+type STTClients struct {
+	stt.STTClientByWorker
+
+	probes map[string]health.ProbeFunc // health probes that differ from the HTTP one
+}
+
+func NewSTTClients(logger *zap.Logger, instances []ModelInstanceConfig) (*STTClients, error) {
+	clients := &STTClients{
+		STTClientByWorker: make(stt.STTClientByWorker, len(instances)),
+		probes:            make(map[string]health.ProbeFunc),
+	}
+
+	for _, instance := range instances {
+		var client stt.STTClient
+		var probe health.ProbeFunc
+
+		switch instance.Backend {
+		case BackendDefault:
+			client = stt.STTClientDefault{Logger: logger}
+
+		case BackendOpenAI:
+			client = stt.STTClientOpenAI{
+				Logger: logger,
+				Options: stt.OpenAIOptions{
+					Model:          instance.Model,
+					Language:       instance.Language,
+					Prompt:         instance.Prompt,
+					Temperature:    instance.Temperature,
+					ResponseFormat: instance.ResponseFormat,
+					APIKey:         instance.APIKey,
+				},
+			}
+
+		case BackendCommand:
+			commandClient, err := stt.NewSTTClientCommand(logger,
+				instance.Command,
+				instance.OutputFormat,
+				time.Duration(instance.ProcessTimeout)*time.Second,
+				len(instance.WorkerIDs()),
+			)
+			if err != nil {
+				return nil, fmt.Errorf("model instance %s: %v", instance.URL, err)
+			}
+			client = commandClient
+			probe = commandClient.Probe
+
+		default:
+			return nil, fmt.Errorf("model instance %s: unknown backend %q", instance.URL, instance.Backend)
+		}
+
+		for _, workerID := range instance.WorkerIDs() {
+			clients.STTClientByWorker[workerID] = client
+			if probe != nil {
+				clients.probes[workerID] = probe
+			}
+		}
+
+		logger.Info("STT client configured",
+			zap.String("worker_url", instance.URL),
+			zap.String("backend", instance.Backend),
+			zap.Strings("worker_ids", instance.WorkerIDs()))
+	}
+
+	return clients, nil
+}
+
+// HealthProbe returns a probe that uses GET url+endpoint for HTTP backends
+// and a backend specific check for the others.
+func (c *STTClients) HealthProbe(endpoint string) health.ProbeFunc {
+	httpProbe := stt.HTTPHealthProbe(nil, endpoint)
+
+	return func(ctx context.Context, workerID string) error {
+		if probe, ok := c.probes[workerID]; ok {
+			return probe(ctx, workerID)
+		}
+		return httpProbe(ctx, workerID)
+	}
+}
@@ -0,0 +1,97 @@
+package subtitles
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"tg-bot-voice-to-text/internal/vtt/stt"
+)
+
+const (
+	SRT    = "srt"
+	WebVTT = "vtt"
+	JSON   = "json"
+)
+
+var Formats = []string{SRT, WebVTT, JSON}
+
+func IsFormat(format string) bool {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// Render returns t as a file in the given format; the format is also the
+// file extension.
+func Render(t stt.Transcription, format string) ([]byte, error) {
+	switch format {
+	case SRT:
+		return []byte(srt(t.Segments)), nil
+	case WebVTT:
+		return []byte(webVTT(t.Segments)), nil
+	case JSON:
+		return json.MarshalIndent(t, "", "  ")
+	default:
+		return nil, fmt.Errorf("unknown subtitle format %q", format)
+	}
+}
+
+func srt(segments []stt.Segment) string {
+	var b strings.Builder
+	for i, s := range segments {
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1,
+			timestamp(s.Start, ","), timestamp(s.End, ","), s.Text)
+	}
+	return b.String()
+}
+
+func webVTT(segments []stt.Segment) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n\n")
+	for _, s := range segments {
+		fmt.Fprintf(&b, "%s --> %s\n%s\n\n",
+			timestamp(s.Start, "."), timestamp(s.End, "."), s.Text)
+	}
+	return b.String()
+}
+
+// timestamp formats seconds as hh:mm:ss<sep>mmm.
+func timestamp(seconds float64, sep string) string {
+	d := time.Duration(seconds * float64(time.Second)).Round(time.Millisecond)
+	if d < 0 {
+		d = 0
+	}
+
+	h := d / time.Hour
+	m := d % time.Hour / time.Minute
+	s := d % time.Minute / time.Second
+	ms := d % time.Second / time.Millisecond
+
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", h, m, s, sep, ms)
+}
+
+// Timestamped returns the text of t with the start of every segment, one
+// segment a line: "[01:05] text", with hours when the audio is that long.
+// Without segments it is the plain text.
+func Timestamped(t stt.Transcription) string {
+	if len(t.Segments) == 0 {
+		return t.Text
+	}
+
+	hours := t.Segments[len(t.Segments)-1].Start >= 3600
+	lines := make([]string, 0, len(t.Segments))
+	for _, s := range t.Segments {
+		d := time.Duration(max(s.Start, 0)) * time.Second
+		start := fmt.Sprintf("%02d:%02d", d/time.Minute, d%time.Minute/time.Second)
+		if hours {
+			start = fmt.Sprintf("%d:%02d:%02d", d/time.Hour, d%time.Hour/time.Minute, d%time.Minute/time.Second)
+		}
+		lines = append(lines, fmt.Sprintf("[%s] %s", start, strings.TrimSpace(s.Text)))
+	}
+	return strings.Join(lines, "\n")
+}
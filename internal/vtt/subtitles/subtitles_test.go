@@ -0,0 +1,63 @@
+package subtitles
+
+import (
+	"encoding/json"
+	"testing"
+
+	"tg-bot-voice-to-text/internal/vtt/stt"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var transcription = stt.Transcription{
+	Text:     "Привет. Как дела?",
+	Language: "ru",
+	Duration: 3661.5,
+	Segments: []stt.Segment{
+		{Start: 0, End: 1.25, Text: "Привет."},
+		{Start: 3600, End: 3661.5, Text: "Как дела?"},
+	},
+}
+
+func TestSRT(t *testing.T) {
+	data, err := Render(transcription, SRT)
+	require.NoError(t, err)
+
+	assert.Equal(t, "1\n00:00:00,000 --> 00:00:01,250\nПривет.\n\n"+
+		"2\n01:00:00,000 --> 01:01:01,500\nКак дела?\n\n", string(data))
+}
+
+func TestWebVTT(t *testing.T) {
+	data, err := Render(transcription, WebVTT)
+	require.NoError(t, err)
+
+	assert.Equal(t, "WEBVTT\n\n"+
+		"00:00:00.000 --> 00:00:01.250\nПривет.\n\n"+
+		"01:00:00.000 --> 01:01:01.500\nКак дела?\n\n", string(data))
+}
+
+func TestJSON(t *testing.T) {
+	data, err := Render(transcription, JSON)
+	require.NoError(t, err)
+
+	var decoded stt.Transcription
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, transcription, decoded)
+}
+
+func TestUnknownFormat(t *testing.T) {
+	_, err := Render(transcription, "docx")
+	assert.Error(t, err)
+	assert.False(t, IsFormat("docx"))
+	assert.True(t, IsFormat(WebVTT))
+}
+
+func TestTimestamped(t *testing.T) {
+	assert.Equal(t, "[0:00:00] Привет.\n[1:00:00] Как дела?", Timestamped(transcription))
+
+	short := stt.Transcription{Text: "a b", Segments: []stt.Segment{{Start: 0, Text: " a"}, {Start: 65.7, Text: " b"}}}
+	assert.Equal(t, "[00:00] a\n[01:05] b", Timestamped(short))
+
+	assert.Equal(t, "plain", Timestamped(stt.Transcription{Text: "plain"}))
+}
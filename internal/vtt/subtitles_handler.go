@@ -0,0 +1,105 @@
+package vtt
+
+import (
+	"context"
+	"fmt"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+
+	"tg-bot-voice-to-text/internal/vtt/settings"
+	"tg-bot-voice-to-text/internal/vtt/stt"
+	"tg-bot-voice-to-text/internal/vtt/subtitles"
+	"tg-bot-voice-to-text/pkg/botwork"
+	"tg-bot-voice-to-text/pkg/utils"
+)
+
+// Subtitle buttons carry the format and the speech language of the result:
+// "subtitles:2:srt:en", "auto" without a language.
+const (
+	subtitlesCallbackPrefix  = "subtitles"
+	subtitlesCallbackVersion = 2
+)
+
+// showResult puts the transcription into the placeholder message, with
+// subtitle export buttons when the backend returned timestamps.
+func (v *SpeechToTextUpdateHandler) showResult(bot *tgbotapi.BotAPI, chatID int64, messageID int, result stt.Transcription, chat settings.Settings) error {
+	if len(result.Segments) == 0 {
+		return v.deliverText(bot, chatID, messageID, v.displayText(result, chat), nil, chat.Language)
+	}
+
+	buttons := make([]tgbotapi.InlineKeyboardButton, 0, len(subtitles.Formats))
+	for _, format := range subtitles.Formats {
+		data, err := botwork.NewCallbackData(subtitlesCallbackPrefix, subtitlesCallbackVersion, format, speechArg(chat.SpeechLanguage)).Encode()
+		if err != nil {
+			return err
+		}
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData("."+format, data))
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(buttons)
+	return v.deliverText(bot, chatID, messageID, v.displayText(result, chat), &keyboard, chat.Language)
+}
+
+// CallbackHandle answers presses of the buttons under results.
+func (v *SpeechToTextUpdateHandler) CallbackHandle(ctx context.Context, bot *tgbotapi.BotAPI, update *tgbotapi.Update) error {
+	query := update.CallbackQuery
+	data, err := botwork.ParseCallbackData(query.Data)
+	if err != nil || data.Prefix != subtitlesCallbackPrefix || query.Message == nil {
+		return utils.AnswerCallback(bot, query.ID, "")
+	}
+
+	log := v.logger.With(
+		zap.Int64("chat_id", query.Message.Chat.ID),
+		zap.Int("message_id", query.Message.MessageID),
+	)
+	if data.Version != subtitlesCallbackVersion {
+		log.Info("Outdated subtitles button pressed", zap.Int("version", data.Version))
+		return utils.AnswerCallback(bot, query.ID, v.catalog.Text(v.callbackLocale(query), "result_expired"))
+	}
+
+	format, speechLanguage := data.Arg(0), parseSpeechArg(data.Arg(1))
+	log = log.With(
+		zap.String("format", format),
+		zap.String("speech_language", speechLanguage),
+	)
+	log.Info("Subtitle export requested")
+
+	if err := v.exportSubtitles(bot, query.Message, format, speechLanguage); err != nil {
+		log.Warn("Subtitle export failed", zap.Error(err))
+		return utils.AnswerCallback(bot, query.ID, v.catalog.Text(v.callbackLocale(query), "result_expired"))
+	}
+
+	return utils.AnswerCallback(bot, query.ID, "")
+}
+
+// exportSubtitles handles a button under a result message: the transcript is
+// taken from the cache by the file of the audio the result replies to.
+func (v *SpeechToTextUpdateHandler) exportSubtitles(bot *tgbotapi.BotAPI, resultMsg *tgbotapi.Message, format, speechLanguage string) error {
+	original := resultMsg.ReplyToMessage
+	if original == nil {
+		return fmt.Errorf("result message is not a reply")
+	}
+
+	file, _, state := v.chooseReactionOnMessage(original, v.catalog.Fallback())
+	if state == skipMessage {
+		return fmt.Errorf("original message has no audio")
+	}
+
+	result, ok := v.results.lookup(file, speechLanguage)
+	if !ok {
+		return fmt.Errorf("no cached transcription for file %s", file.ID)
+	}
+
+	return v.sendSubtitles(bot, original, result, format)
+}
+
+// sendSubtitles replies to the original audio message with the transcript file.
+func (v *SpeechToTextUpdateHandler) sendSubtitles(bot *tgbotapi.BotAPI, original *tgbotapi.Message, result stt.Transcription, format string) error {
+	data, err := subtitles.Render(result, format)
+	if err != nil {
+		return err
+	}
+
+	return utils.SendDocumentReply(bot, original.Chat.ID, original.MessageID, "transcription."+format, data)
+}
@@ -0,0 +1,71 @@
+package botwork
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxCallbackDataLength is the Telegram limit of inline button data, in bytes.
+const MaxCallbackDataLength = 64
+
+var ErrCallbackDataTooLong = errors.New("callback data is longer than 64 bytes")
+
+// CallbackData is the data of an inline button, encoded as
+// "<prefix>:<version>:<arg>:...". The prefix selects the handler, see
+// Router.Callback; the version lets a handler recognize buttons of messages
+// sent before it changed their arguments.
+type CallbackData struct {
+	Prefix  string
+	Version int
+	Args    []string
+}
+
+func NewCallbackData(prefix string, version int, args ...string) CallbackData {
+	return CallbackData{Prefix: prefix, Version: version, Args: args}
+}
+
+func (d CallbackData) Encode() (string, error) {
+	if d.Prefix == "" || d.Version <= 0 {
+		return "", fmt.Errorf("callback data needs a prefix and a positive version")
+	}
+	for _, part := range append([]string{d.Prefix}, d.Args...) {
+		if strings.Contains(part, ":") {
+			return "", fmt.Errorf("callback data part %q contains ':'", part)
+		}
+	}
+
+	data := d.Prefix + ":" + strconv.Itoa(d.Version)
+	for _, arg := range d.Args {
+		data += ":" + arg
+	}
+	if len(data) > MaxCallbackDataLength {
+		return "", fmt.Errorf("%w: %s", ErrCallbackDataTooLong, data)
+	}
+	return data, nil
+}
+
+// Arg returns the i-th argument, empty if there are fewer.
+func (d CallbackData) Arg(i int) string {
+	if i < len(d.Args) {
+		return d.Args[i]
+	}
+	return ""
+}
+
+func ParseCallbackData(data string) (CallbackData, error) {
+	parts := strings.Split(data, ":")
+	if parts[0] == "" {
+		return CallbackData{}, fmt.Errorf("callback data %q has no prefix", data)
+	}
+
+	if len(parts) < 2 {
+		return CallbackData{}, fmt.Errorf("callback data %q has no version", data)
+	}
+	version, err := strconv.Atoi(parts[1])
+	if err != nil || version <= 0 {
+		return CallbackData{}, fmt.Errorf("callback data %q has no version", data)
+	}
+	return CallbackData{Prefix: parts[0], Version: version, Args: parts[2:]}, nil
+}
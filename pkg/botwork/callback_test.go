@@ -0,0 +1,40 @@
+package botwork
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallbackDataRoundTrip(t *testing.T) {
+	data, err := NewCallbackData("settings", 2, "lang", "en").Encode()
+	require.NoError(t, err)
+	assert.Equal(t, "settings:2:lang:en", data)
+
+	d, err := ParseCallbackData(data)
+	require.NoError(t, err)
+	assert.Equal(t, NewCallbackData("settings", 2, "lang", "en"), d)
+	assert.Equal(t, "en", d.Arg(1))
+	assert.Equal(t, "", d.Arg(2))
+}
+
+func TestParseRejectsBadCallbackData(t *testing.T) {
+	_, err := ParseCallbackData(":1:x")
+	assert.Error(t, err)
+
+	_, err = ParseCallbackData("settings:lang")
+	assert.Error(t, err, "no version")
+}
+
+func TestEncodeRejectsBadCallbackData(t *testing.T) {
+	_, err := NewCallbackData("settings", 1, "a:b").Encode()
+	assert.Error(t, err)
+
+	_, err = NewCallbackData("settings", 0).Encode()
+	assert.Error(t, err)
+
+	_, err = NewCallbackData("settings", 1, strings.Repeat("x", 60)).Encode()
+	assert.ErrorIs(t, err, ErrCallbackDataTooLong)
+}
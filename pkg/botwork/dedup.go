@@ -0,0 +1,189 @@
+package botwork
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Deduplicator remembers the last window update IDs, so that an update
+// Telegram delivers again is handled at most once. With a path the IDs are
+// also appended to a file and survive a restart of the process; the file is
+// compacted to the window once it grows twice as large.
+type Deduplicator struct {
+	logger *zap.Logger
+
+	window int
+	path   string
+
+	mu    sync.Mutex
+	seen  map[int]struct{}
+	order []int // ring of remembered IDs, next points at the oldest
+	next  int
+	file  *os.File
+	lines int
+}
+
+// NewDeduplicator loads the remembered IDs from path; an empty path keeps
+// them in memory only.
+func NewDeduplicator(logger *zap.Logger, window int, path string) (*Deduplicator, error) {
+	if window <= 0 {
+		window = 1
+	}
+
+	d := &Deduplicator{
+		logger: logger.With(zap.String("component", "deduplicator")),
+		window: window,
+		path:   path,
+		seen:   make(map[int]struct{}, window),
+		order:  make([]int, 0, window),
+	}
+
+	if path != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, fmt.Errorf("error in creating update id store directory: %w", err)
+		}
+		if err := d.load(); err != nil {
+			return nil, err
+		}
+		if err := d.compact(); err != nil {
+			return nil, err
+		}
+	}
+
+	d.logger.Info("deduplicator initialized",
+		zap.Int("window", window),
+		zap.String("path", path),
+		zap.Int("loaded", len(d.seen)))
+	return d, nil
+}
+
+// Seen reports whether the update ID is remembered.
+func (d *Deduplicator) Seen(updateID int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	_, ok := d.seen[updateID]
+	return ok
+}
+
+// MarkSeen remembers the update ID and reports whether it is new. An error
+// means the ID could not be persisted; it is still remembered in memory.
+func (d *Deduplicator) MarkSeen(updateID int) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.seen[updateID]; ok {
+		return false, nil
+	}
+	d.remember(updateID)
+
+	if d.file == nil {
+		return true, nil
+	}
+
+	if _, err := fmt.Fprintln(d.file, updateID); err != nil {
+		return true, fmt.Errorf("error in writing update id: %w", err)
+	}
+	d.lines++
+	if d.lines >= 2*d.window {
+		if err := d.compact(); err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+func (d *Deduplicator) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.file == nil {
+		return nil
+	}
+	err := d.file.Close()
+	d.file = nil
+	return err
+}
+
+func (d *Deduplicator) remember(updateID int) {
+	if len(d.order) < d.window {
+		d.order = append(d.order, updateID)
+	} else {
+		delete(d.seen, d.order[d.next])
+		d.order[d.next] = updateID
+		d.next = (d.next + 1) % d.window
+	}
+	d.seen[updateID] = struct{}{}
+}
+
+func (d *Deduplicator) load() error {
+	file, err := os.Open(d.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error in opening update id store: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		updateID, err := strconv.Atoi(scanner.Text())
+		if err != nil { // a line cut by a crash
+			continue
+		}
+		if _, ok := d.seen[updateID]; !ok {
+			d.remember(updateID)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error in reading update id store: %w", err)
+	}
+	return nil
+}
+
+// compact rewrites the file with the remembered IDs only, oldest first.
+func (d *Deduplicator) compact() error {
+	if d.file != nil {
+		if err := d.file.Close(); err != nil {
+			d.logger.Warn("failed to close update id store", zap.Error(err))
+		}
+		d.file = nil
+	}
+
+	tmpPath := d.path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("error in creating update id store: %w", err)
+	}
+
+	w := bufio.NewWriter(tmp)
+	for i := range d.order {
+		fmt.Fprintln(w, d.order[(d.next+i)%len(d.order)])
+	}
+	if err := w.Flush(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error in writing update id store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error in writing update id store: %w", err)
+	}
+	if err := os.Rename(tmpPath, d.path); err != nil {
+		return fmt.Errorf("error in replacing update id store: %w", err)
+	}
+
+	d.file, err = os.OpenFile(d.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("error in opening update id store: %w", err)
+	}
+	d.lines = len(d.order)
+	return nil
+}
@@ -0,0 +1,145 @@
+package botwork
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func markSeen(t *testing.T, d *Deduplicator, updateID int) bool {
+	first, err := d.MarkSeen(updateID)
+	require.NoError(t, err)
+	return first
+}
+
+func TestDeduplicatorWindow(t *testing.T) {
+	d, err := NewDeduplicator(zap.NewNop(), 3, "")
+	require.NoError(t, err)
+
+	for _, id := range []int{1, 2, 3} {
+		assert.True(t, markSeen(t, d, id))
+	}
+	assert.False(t, markSeen(t, d, 2))
+
+	// 4 pushes 1 out of the window
+	assert.True(t, markSeen(t, d, 4))
+	assert.True(t, markSeen(t, d, 1))
+	assert.False(t, markSeen(t, d, 4))
+}
+
+func TestDeduplicatorSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "update_ids")
+
+	d, err := NewDeduplicator(zap.NewNop(), 3, path)
+	require.NoError(t, err)
+	for id := 1; id <= 10; id++ {
+		assert.True(t, markSeen(t, d, id))
+	}
+	require.NoError(t, d.Close())
+
+	// compaction keeps the file about the window size
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(strings.Fields(string(data))), 6)
+
+	d, err = NewDeduplicator(zap.NewNop(), 3, path)
+	require.NoError(t, err)
+	defer d.Close()
+
+	for _, id := range []int{8, 9, 10} {
+		assert.False(t, markSeen(t, d, id), "update %d", id)
+	}
+	assert.True(t, markSeen(t, d, 7))
+}
+
+func TestDispatcherSkipsDuplicates(t *testing.T) {
+	handled := make(chan int, 4)
+	uh := handlerFunc(func(ctx context.Context, update *tgbotapi.Update) error {
+		handled <- update.UpdateID
+		return nil
+	})
+
+	dedup, err := NewDeduplicator(zap.NewNop(), 10, "")
+	require.NoError(t, err)
+
+	d := NewDispatcher(context.Background(), zap.NewNop(), nil, uh, 1)
+	d.SetDeduplicator(dedup)
+	for _, id := range []int{1, 2, 1, 2} {
+		require.NoError(t, d.Dispatch(context.Background(), chatUpdate(id, 1)))
+	}
+	d.Shutdown(time.Second)
+	close(handled)
+
+	var ids []int
+	for id := range handled {
+		ids = append(ids, id)
+	}
+	assert.Equal(t, []int{1, 2}, ids)
+	assert.Equal(t, DispatcherStats{Handled: 2, Duplicates: 2}, d.Stats())
+}
+
+func TestDispatcherHandlesUpdateCutByRestart(t *testing.T) {
+	dir := t.TempDir()
+	dedupPath, offsetPath := filepath.Join(dir, "update_ids"), filepath.Join(dir, "offset")
+
+	newDispatcher := func(uh UpdateHandler) (*Dispatcher, *Deduplicator, *OffsetTracker) {
+		dedup, err := NewDeduplicator(zap.NewNop(), 10, dedupPath)
+		require.NoError(t, err)
+		offsets, err := NewOffsetTracker(zap.NewNop(), offsetPath)
+		require.NoError(t, err)
+
+		d := NewDispatcher(context.Background(), zap.NewNop(), nil, uh, 1)
+		d.SetDeduplicator(dedup)
+		d.SetOffsetTracker(offsets)
+		return d, dedup, offsets
+	}
+
+	// the process dies while update 2 is being handled
+	started := make(chan int, 2)
+	release := make(chan struct{})
+	crashed, crashedDedup, _ := newDispatcher(handlerFunc(func(ctx context.Context, update *tgbotapi.Update) error {
+		started <- update.UpdateID
+		if update.UpdateID == 2 {
+			<-release
+		}
+		return nil
+	}))
+	require.NoError(t, crashed.Dispatch(context.Background(), chatUpdate(1, 1)))
+	require.NoError(t, crashed.Dispatch(context.Background(), chatUpdate(2, 1)))
+	assert.Equal(t, 1, <-started)
+	assert.Equal(t, 2, <-started)
+	defer func() {
+		close(release)
+		crashed.Shutdown(time.Second)
+		_ = crashedDedup.Close()
+	}()
+
+	// after the restart Telegram sends again everything above the offset
+	handled := make(chan int, 2)
+	d, dedup, offsets := newDispatcher(handlerFunc(func(ctx context.Context, update *tgbotapi.Update) error {
+		handled <- update.UpdateID
+		return nil
+	}))
+	defer dedup.Close()
+	assert.Equal(t, 1, offsets.Committed())
+
+	require.NoError(t, d.Dispatch(context.Background(), chatUpdate(2, 1)))
+	d.Shutdown(time.Second)
+	close(handled)
+
+	var ids []int
+	for id := range handled {
+		ids = append(ids, id)
+	}
+	assert.Equal(t, []int{2}, ids, "the update cut by the restart is handled again")
+	assert.Equal(t, 2, offsets.Committed())
+	assert.True(t, dedup.Seen(2))
+}
@@ -0,0 +1,329 @@
+package botwork
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+)
+
+// ErrSaturated is returned by TryDispatch when no more updates can be queued.
+var ErrSaturated = errors.New("dispatcher is saturated")
+
+// chatQueueLimit is the number of updates that may wait behind the running
+// one of a chat.
+const chatQueueLimit = 32
+
+// Dispatcher runs update handlers concurrently, at most concurrency at a time.
+// Updates of one chat are handled one by one in the order they were
+// dispatched. Handlers get a context of their own, so that on shutdown they
+// can finish within a grace period instead of being canceled right away.
+//
+// Admission is counted separately for new chats and for chat queues: at most
+// concurrency updates may wait for a free handler, and each busy chat may
+// queue up to chatQueueLimit more, so a chat with a backlog does not hold
+// back the others.
+type Dispatcher struct {
+	logger *zap.Logger
+
+	bot     *tgbotapi.BotAPI
+	uh      UpdateHandler
+	dedup   *Deduplicator
+	offsets *OffsetTracker
+
+	running chan struct{} // handlers being executed
+	waiting chan struct{} // updates of idle chats not yet started
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu         sync.Mutex
+	chats      map[int64][]*tgbotapi.Update // updates queued behind the running one
+	pending    map[int]struct{}             // IDs of the dispatched updates not yet handled
+	queueLimit int
+	freed      chan struct{} // closed when a waiting slot or a place in a chat queue is freed
+	wg         sync.WaitGroup
+
+	handled    atomic.Int64
+	failed     atomic.Int64
+	panicked   atomic.Int64
+	duplicates atomic.Int64
+
+	errOnce sync.Once
+	errs    chan error
+}
+
+// DispatcherStats counts handled updates; Failed includes Panicked.
+// Duplicates are updates skipped as already seen.
+type DispatcherStats struct {
+	Handled    int64
+	Failed     int64
+	Panicked   int64
+	Duplicates int64
+}
+
+func NewDispatcher(ctx context.Context, logger *zap.Logger, bot *tgbotapi.BotAPI, uh UpdateHandler, concurrency int) *Dispatcher {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+
+	return &Dispatcher{
+		logger:     logger.With(zap.String("component", "dispatcher")),
+		bot:        bot,
+		uh:         uh,
+		running:    make(chan struct{}, concurrency),
+		waiting:    make(chan struct{}, concurrency),
+		ctx:        ctx,
+		cancel:     cancel,
+		chats:      make(map[int64][]*tgbotapi.Update),
+		pending:    make(map[int]struct{}),
+		queueLimit: chatQueueLimit,
+		freed:      make(chan struct{}),
+		errs:       make(chan error, 1),
+	}
+}
+
+// SetDeduplicator makes the dispatcher skip updates it has already seen. An
+// update is remembered once it is handled, together with its offset, so one
+// cut short by a crash is handled again after a restart. Must be called
+// before the first Dispatch.
+func (d *Dispatcher) SetDeduplicator(dedup *Deduplicator) {
+	d.dedup = dedup
+}
+
+// SetOffsetTracker makes the dispatcher report started and handled updates.
+// Must be called before the first Dispatch.
+func (d *Dispatcher) SetOffsetTracker(offsets *OffsetTracker) {
+	d.offsets = offsets
+}
+
+// Dispatch queues the update. It blocks while concurrency updates are already
+// waiting for a free handler, or the queue of the chat is full, or until ctx
+// is done.
+func (d *Dispatcher) Dispatch(ctx context.Context, update *tgbotapi.Update) error {
+	for {
+		freed, ok := d.dispatch(update)
+		if ok {
+			return nil
+		}
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// TryDispatch queues the update like Dispatch but returns ErrSaturated
+// instead of blocking.
+func (d *Dispatcher) TryDispatch(update *tgbotapi.Update) error {
+	if _, ok := d.dispatch(update); !ok {
+		return ErrSaturated
+	}
+	return nil
+}
+
+// dispatch queues the update if there is room for it, otherwise it returns
+// a channel closed once some room is freed.
+func (d *Dispatcher) dispatch(update *tgbotapi.Update) (<-chan struct{}, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	chat := update.FromChat()
+	ordered := chat != nil && !d.unordered(update)
+
+	var queue []*tgbotapi.Update
+	busy := false
+	if ordered {
+		queue, busy = d.chats[chat.ID]
+		if busy && len(queue) >= d.queueLimit {
+			return d.freed, false
+		}
+	}
+	if !busy {
+		select {
+		case d.waiting <- struct{}{}:
+		default:
+			return d.freed, false
+		}
+	}
+
+	if d.offsets != nil {
+		d.offsets.Start(update.UpdateID)
+	}
+
+	if d.duplicate(update.UpdateID) {
+		if !busy {
+			d.releaseWaiting()
+		}
+		if d.offsets != nil {
+			d.offsets.Done(update.UpdateID)
+		}
+		d.duplicates.Add(1)
+		d.logger.Info("skip duplicate update", zap.Int("update_id", update.UpdateID))
+		return nil, true
+	}
+	d.pending[update.UpdateID] = struct{}{}
+
+	switch {
+	case !ordered:
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			d.handle(update, true)
+		}()
+	case busy:
+		d.chats[chat.ID] = append(queue, update)
+	default:
+		d.chats[chat.ID] = nil
+		d.wg.Add(1)
+		go d.runChat(chat.ID, update)
+	}
+	return nil, true
+}
+
+// Err returns a channel that receives the first fatal handler error, see
+// IsFatal. Other errors are logged and counted.
+func (d *Dispatcher) Err() <-chan error {
+	return d.errs
+}
+
+func (d *Dispatcher) Stats() DispatcherStats {
+	return DispatcherStats{
+		Handled:    d.handled.Load(),
+		Failed:     d.failed.Load(),
+		Panicked:   d.panicked.Load(),
+		Duplicates: d.duplicates.Load(),
+	}
+}
+
+// Shutdown waits for dispatched updates to be handled. Handlers still running
+// after gracePeriod have their context canceled; Shutdown returns once they
+// return.
+func (d *Dispatcher) Shutdown(gracePeriod time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(gracePeriod)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		d.logger.Info("all update handlers finished")
+	case <-timer.C:
+		d.logger.Warn("grace period is over, canceling update handlers",
+			zap.Duration("grace_period", gracePeriod))
+		d.cancel()
+		<-done
+	}
+	d.cancel()
+}
+
+func (d *Dispatcher) runChat(chatID int64, update *tgbotapi.Update) {
+	defer d.wg.Done()
+
+	// the first update holds a waiting slot, the queued ones do not
+	for waiting := true; ; waiting = false {
+		d.handle(update, waiting)
+
+		d.mu.Lock()
+		queue := d.chats[chatID]
+		if len(queue) == 0 {
+			delete(d.chats, chatID)
+			d.mu.Unlock()
+			return
+		}
+		update = queue[0]
+		d.chats[chatID] = queue[1:]
+		d.notifyFreed()
+		d.mu.Unlock()
+	}
+}
+
+// handle runs the update once a handler is free; waiting tells that the
+// update holds a waiting slot to give back then.
+func (d *Dispatcher) handle(update *tgbotapi.Update, waiting bool) {
+	d.running <- struct{}{}
+	if waiting {
+		d.mu.Lock()
+		d.releaseWaiting()
+		d.mu.Unlock()
+	}
+	defer func() { <-d.running }()
+	defer d.done(update)
+
+	logger := d.logger.With(zap.Int("update_id", update.UpdateID))
+	logger.Info("start update handle")
+
+	err := handleUpdate(d.ctx, d.uh, d.bot, update)
+	d.handled.Add(1)
+	if err == nil {
+		logger.Info("done update handle")
+		return
+	}
+
+	d.failed.Add(1)
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		d.panicked.Add(1)
+	}
+	logHandleError(d.logger, update, err)
+
+	if IsFatal(err) {
+		d.errOnce.Do(func() { d.errs <- err })
+	}
+}
+
+// releaseWaiting gives back a waiting slot; d.mu must be held.
+func (d *Dispatcher) releaseWaiting() {
+	<-d.waiting
+	d.notifyFreed()
+}
+
+// notifyFreed wakes up the Dispatch calls waiting for room; d.mu must be
+// held.
+func (d *Dispatcher) notifyFreed() {
+	close(d.freed)
+	d.freed = make(chan struct{})
+}
+
+func (d *Dispatcher) unordered(update *tgbotapi.Update) bool {
+	u, ok := d.uh.(UnorderedUpdates)
+	return ok && u.Unordered(update)
+}
+
+// duplicate reports whether the update is being handled or was handled
+// before; d.mu must be held.
+func (d *Dispatcher) duplicate(updateID int) bool {
+	if _, ok := d.pending[updateID]; ok {
+		return true
+	}
+	return d.dedup != nil && d.dedup.Seen(updateID)
+}
+
+// done remembers the handled update and commits its offset.
+func (d *Dispatcher) done(update *tgbotapi.Update) {
+	if d.dedup != nil {
+		if _, err := d.dedup.MarkSeen(update.UpdateID); err != nil {
+			d.logger.Warn("failed to persist update id", zap.Int("update_id", update.UpdateID), zap.Error(err))
+		}
+	}
+
+	d.mu.Lock()
+	delete(d.pending, update.UpdateID)
+	d.mu.Unlock()
+
+	if d.offsets != nil {
+		d.offsets.Done(update.UpdateID)
+	}
+}
@@ -0,0 +1,231 @@
+package botwork
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type handlerFunc func(ctx context.Context, update *tgbotapi.Update) error
+
+func (f handlerFunc) UpdateHandle(ctx context.Context, _ *tgbotapi.BotAPI, update *tgbotapi.Update) error {
+	return f(ctx, update)
+}
+
+func chatUpdate(updateID int, chatID int64) *tgbotapi.Update {
+	return &tgbotapi.Update{
+		UpdateID: updateID,
+		Message:  &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: chatID}},
+	}
+}
+
+func TestDispatcherKeepsChatOrder(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		handled = map[int64][]int{}
+	)
+	uh := handlerFunc(func(ctx context.Context, update *tgbotapi.Update) error {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		chatID := update.Message.Chat.ID
+		handled[chatID] = append(handled[chatID], update.UpdateID)
+		return nil
+	})
+
+	d := NewDispatcher(context.Background(), zap.NewNop(), nil, uh, 4)
+	for i := range 30 {
+		require.NoError(t, d.Dispatch(context.Background(), chatUpdate(i, int64(i%3))))
+	}
+	d.Shutdown(time.Second)
+
+	for chatID := range int64(3) {
+		var want []int
+		for i := int(chatID); i < 30; i += 3 {
+			want = append(want, i)
+		}
+		assert.Equal(t, want, handled[chatID])
+	}
+}
+
+func TestDispatcherRunsChatsConcurrently(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan int64, 2)
+	uh := handlerFunc(func(ctx context.Context, update *tgbotapi.Update) error {
+		started <- update.Message.Chat.ID
+		<-release
+		return nil
+	})
+
+	d := NewDispatcher(context.Background(), zap.NewNop(), nil, uh, 2)
+	require.NoError(t, d.Dispatch(context.Background(), chatUpdate(1, 1)))
+	require.NoError(t, d.Dispatch(context.Background(), chatUpdate(2, 2)))
+
+	// both chats are handled at once, the slow one does not block the other
+	assert.ElementsMatch(t, []int64{1, 2}, []int64{<-started, <-started})
+
+	close(release)
+	d.Shutdown(time.Second)
+}
+
+func TestDispatcherBlocksWhenSaturated(t *testing.T) {
+	release := make(chan struct{})
+	uh := handlerFunc(func(ctx context.Context, update *tgbotapi.Update) error {
+		<-release
+		return nil
+	})
+
+	d := NewDispatcher(context.Background(), zap.NewNop(), nil, uh, 1)
+	require.NoError(t, d.Dispatch(context.Background(), chatUpdate(1, 1)))
+	require.NoError(t, d.Dispatch(context.Background(), chatUpdate(2, 2))) // waits for the running one
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, d.Dispatch(ctx, chatUpdate(3, 3)), context.DeadlineExceeded)
+	assert.ErrorIs(t, d.TryDispatch(chatUpdate(3, 3)), ErrSaturated)
+
+	close(release)
+	d.Shutdown(time.Second)
+}
+
+func TestDispatcherChatBacklogDoesNotBlockOtherChats(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan int, 5)
+	uh := handlerFunc(func(ctx context.Context, update *tgbotapi.Update) error {
+		started <- update.UpdateID
+		if update.Message.Chat.ID == 1 {
+			<-release
+		}
+		return nil
+	})
+
+	d := NewDispatcher(context.Background(), zap.NewNop(), nil, uh, 2)
+	for id := 1; id <= 3; id++ {
+		require.NoError(t, d.Dispatch(context.Background(), chatUpdate(id, 1)))
+	}
+	assert.Equal(t, 1, <-started)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, d.Dispatch(ctx, chatUpdate(4, 2)))
+	require.NoError(t, d.TryDispatch(chatUpdate(5, 3)))
+	assert.ElementsMatch(t, []int{4, 5}, []int{<-started, <-started})
+
+	close(release)
+	d.Shutdown(time.Second)
+	assert.Equal(t, DispatcherStats{Handled: 5}, d.Stats())
+}
+
+func TestDispatcherLimitsChatQueue(t *testing.T) {
+	release := make(chan struct{})
+	uh := handlerFunc(func(ctx context.Context, update *tgbotapi.Update) error {
+		<-release
+		return nil
+	})
+
+	d := NewDispatcher(context.Background(), zap.NewNop(), nil, uh, 2)
+	d.queueLimit = 2
+	for id := 1; id <= 3; id++ {
+		require.NoError(t, d.Dispatch(context.Background(), chatUpdate(id, 1)))
+	}
+	assert.ErrorIs(t, d.TryDispatch(chatUpdate(4, 1)), ErrSaturated)
+
+	dispatched := make(chan error, 1)
+	go func() { dispatched <- d.Dispatch(context.Background(), chatUpdate(4, 1)) }()
+	select {
+	case <-dispatched:
+		t.Fatal("dispatch to a full chat queue returned")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release) // the queue moves, update 4 gets its place
+	assert.NoError(t, <-dispatched)
+	d.Shutdown(time.Second)
+	assert.Equal(t, DispatcherStats{Handled: 4}, d.Stats())
+}
+
+func TestDispatcherShutdownGracePeriod(t *testing.T) {
+	uh := handlerFunc(func(ctx context.Context, update *tgbotapi.Update) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	parent, cancel := context.WithCancel(context.Background())
+	d := NewDispatcher(parent, zap.NewNop(), nil, uh, 1)
+	require.NoError(t, d.Dispatch(parent, chatUpdate(1, 1)))
+
+	// the parent context does not cancel running handlers
+	cancel()
+	start := time.Now()
+	d.Shutdown(50 * time.Millisecond)
+
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	assert.Equal(t, DispatcherStats{Handled: 1, Failed: 1}, d.Stats())
+}
+
+func TestDispatcherReportsOnlyFatalErrors(t *testing.T) {
+	errFailed := errors.New("failed")
+	uh := handlerFunc(func(ctx context.Context, update *tgbotapi.Update) error {
+		switch update.UpdateID {
+		case 1:
+			return errFailed
+		case 2:
+			panic("boom")
+		default:
+			return Fatal(&tgbotapi.Error{Code: 401, Message: "Unauthorized"})
+		}
+	})
+
+	d := NewDispatcher(context.Background(), zap.NewNop(), nil, uh, 2)
+	require.NoError(t, d.Dispatch(context.Background(), chatUpdate(1, 1)))
+	require.NoError(t, d.Dispatch(context.Background(), &tgbotapi.Update{UpdateID: 2}))
+	require.NoError(t, d.Dispatch(context.Background(), chatUpdate(3, 1)))
+	d.Shutdown(time.Second)
+
+	assert.ErrorIs(t, <-d.Err(), ErrFatal)
+	assert.Equal(t, DispatcherStats{Handled: 3, Failed: 3, Panicked: 1}, d.Stats())
+}
+
+func TestDispatcherCallbackSkipsChatQueue(t *testing.T) {
+	release := make(chan struct{})
+	answered := make(chan struct{})
+
+	r := NewRouter(zap.NewNop())
+	r.Message(HandlerFunc(func(ctx context.Context, bot *tgbotapi.BotAPI, update *tgbotapi.Update) error {
+		<-release
+		return nil
+	}))
+	r.CallbackQuery(HandlerFunc(func(ctx context.Context, bot *tgbotapi.BotAPI, update *tgbotapi.Update) error {
+		close(answered)
+		return nil
+	}))
+
+	callback := &tgbotapi.Update{
+		UpdateID: 2,
+		CallbackQuery: &tgbotapi.CallbackQuery{
+			ID:      "1",
+			Data:    "settings:1:lang",
+			Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 1}},
+		},
+	}
+
+	d := NewDispatcher(context.Background(), zap.NewNop(), nil, r, 2)
+	require.NoError(t, d.Dispatch(context.Background(), chatUpdate(1, 1)))
+	require.NoError(t, d.Dispatch(context.Background(), callback))
+
+	select {
+	case <-answered:
+	case <-time.After(time.Second):
+		t.Fatal("callback query waited for the earlier update of its chat")
+	}
+
+	close(release)
+	d.Shutdown(time.Second)
+}
@@ -0,0 +1,73 @@
+package botwork
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+)
+
+// ErrFatal marks handler errors after which the bot can not go on. Any other
+// handler error only fails its own update.
+var ErrFatal = errors.New("fatal bot error")
+
+// Fatal marks err as fatal for the bot.
+func Fatal(err error) error {
+	return fmt.Errorf("%w: %w", ErrFatal, err)
+}
+
+// IsFatal reports whether the bot must stop after err: the error is marked by
+// Fatal, or Telegram no longer accepts the bot token.
+func IsFatal(err error) bool {
+	if errors.Is(err, ErrFatal) {
+		return true
+	}
+
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusUnauthorized
+	}
+	return false
+}
+
+// PanicError is a recovered panic of an update handler.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic in update handler: %v", e.Value)
+}
+
+// handleUpdate runs the handler, turning its panic into a *PanicError.
+func handleUpdate(ctx context.Context, uh UpdateHandler, bot *tgbotapi.BotAPI, update *tgbotapi.Update) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+
+	return uh.UpdateHandle(ctx, bot, update)
+}
+
+// logHandleError logs a failed update; panics are logged with their stack.
+func logHandleError(logger *zap.Logger, update *tgbotapi.Update, err error) {
+	logger = logger.With(zap.Int("update_id", update.UpdateID))
+
+	var panicErr *PanicError
+	switch {
+	case errors.As(err, &panicErr):
+		logger.Error("panic in update handler",
+			zap.Any("panic", panicErr.Value),
+			zap.ByteString("stack", panicErr.Stack))
+	case IsFatal(err):
+		logger.Error("fatal error in update handler", zap.Error(err))
+	default:
+		logger.Warn("failed update handle", zap.Error(err))
+	}
+}
@@ -0,0 +1,37 @@
+package botwork
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsFatal(t *testing.T) {
+	unauthorized := &tgbotapi.Error{Code: 401, Message: "Unauthorized"}
+	deleted := &tgbotapi.Error{Code: 400, Message: "Bad Request: message to edit not found"}
+
+	assert.True(t, IsFatal(fmt.Errorf("error in edit message: %w", unauthorized)))
+	assert.True(t, IsFatal(Fatal(errors.New("broken config"))))
+	assert.False(t, IsFatal(fmt.Errorf("error in edit message: %w", deleted)))
+	assert.False(t, IsFatal(context.DeadlineExceeded))
+}
+
+func TestHandleUpdateRecoversPanic(t *testing.T) {
+	uh := handlerFunc(func(ctx context.Context, update *tgbotapi.Update) error {
+		var m map[string]int
+		m["boom"]++
+		return nil
+	})
+
+	err := handleUpdate(context.Background(), uh, nil, &tgbotapi.Update{UpdateID: 7})
+
+	var panicErr *PanicError
+	require.ErrorAs(t, err, &panicErr)
+	assert.Contains(t, string(panicErr.Stack), "TestHandleUpdateRecoversPanic")
+	assert.False(t, IsFatal(err))
+}
@@ -3,61 +3,197 @@ package botwork
 import (
 	"context"
 	"fmt"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"go.uber.org/zap"
 )
 
+// pollRetryDelay is the pause after a failed getUpdates.
+const pollRetryDelay = 3 * time.Second
+
+// LongPollingBot polls getUpdates itself instead of tgbotapi.GetUpdatesChan
+// to resume from the committed update ID of the OffsetTracker after a
+// restart. While running it polls past the dispatched updates, so a slow
+// update does not hold back the updates of other chats; the committed ID
+// is still the last one handled together with all before it.
 type LongPollingBot struct {
 	name   string
 	logger *zap.Logger
 
 	bot     *tgbotapi.BotAPI
-	updates tgbotapi.UpdatesChannel
 	uh      UpdateHandler
+	timeout int
+
+	concurrency   int
+	gracePeriod   time.Duration
+	dedup         *Deduplicator
+	offsets       *OffsetTracker
+	skipOlderThan time.Duration
 }
 
-func NewLongPollingBot(logger *zap.Logger, name string, apiToken string, uh UpdateHandler, timeout int, debug bool) (*LongPollingBot, error) {
+func NewLongPollingBot(logger *zap.Logger, name string, apiToken string, uh UpdateHandler, timeout int, debug bool, concurrency int, gracePeriod time.Duration, dedup *Deduplicator, offsets *OffsetTracker, skipOlderThan time.Duration) (*LongPollingBot, error) {
 	bot, err := tgbotapi.NewBotAPI(apiToken)
 	if err != nil {
 		return nil, err
 	}
 
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = timeout
 	bot.Debug = debug
 
 	logger = logger.With(zap.String("name", name))
-	logger.Info("create new long-polling bot")
+	logger.Info("create new long-polling bot",
+		zap.Int("concurrency", concurrency),
+		zap.Duration("grace_period", gracePeriod),
+		zap.Duration("skip_older_than", skipOlderThan))
+
+	if offsets == nil {
+		if offsets, err = NewOffsetTracker(logger, ""); err != nil {
+			return nil, err
+		}
+	}
 
 	return &LongPollingBot{
 		name:    name,
 		logger:  logger,
 		bot:     bot,
-		updates: bot.GetUpdatesChan(u),
 		uh:      uh,
+		timeout: timeout,
+
+		concurrency:   concurrency,
+		gracePeriod:   gracePeriod,
+		dedup:         dedup,
+		offsets:       offsets,
+		skipOlderThan: skipOlderThan,
 	}, nil
 }
 
 func (lpb *LongPollingBot) Start(ctx context.Context) error {
-	lpb.logger.Info("start bot")
+	lpb.logger.Info("start bot", zap.Int("offset", lpb.offsets.Committed()+1))
+
+	if err := initHandler(ctx, lpb.uh, lpb.bot); err != nil {
+		lpb.logger.Error("failed to init update handler", zap.Error(err))
+		return err
+	}
 
+	dispatcher := NewDispatcher(ctx, lpb.logger, lpb.bot, lpb.uh, lpb.concurrency)
+	dispatcher.SetOffsetTracker(lpb.offsets)
+	if lpb.dedup != nil {
+		dispatcher.SetDeduplicator(lpb.dedup)
+	}
+	defer func() {
+		lpb.logger.Info("draining update handlers")
+		dispatcher.Shutdown(lpb.gracePeriod)
+
+		stats := dispatcher.Stats()
+		lpb.logger.Info("bot stopped",
+			zap.Int64("handled", stats.Handled),
+			zap.Int64("failed", stats.Failed),
+			zap.Int64("panicked", stats.Panicked),
+			zap.Int64("duplicates", stats.Duplicates),
+			zap.Int("committed", lpb.offsets.Committed()))
+	}()
+
+	lastDispatched := lpb.offsets.Committed()
 	for {
 		select {
+		case err := <-dispatcher.Err():
+			lpb.logger.Error("stop bot on fatal error", zap.Error(err))
+			return fmt.Errorf("error in update handler: %w", err)
+		default:
+		}
 
-		case <-ctx.Done():
+		updates, err := lpb.getUpdates(ctx, lastDispatched+1)
+		if ctx.Err() != nil {
 			lpb.logger.Error("contex done (timeout/context canceled/...)", zap.Error(ctx.Err()))
 			return ctx.Err()
+		}
+		if err != nil {
+			if IsFatal(err) {
+				lpb.logger.Error("stop bot on fatal getUpdates error", zap.Error(err))
+				return fmt.Errorf("error in getUpdates: %w", err)
+			}
+			lpb.logger.Warn("failed to get updates, retrying", zap.Error(err))
+			if err := sleepCtx(ctx, pollRetryDelay); err != nil {
+				return err
+			}
+			continue
+		}
 
-		case update := <-lpb.updates:
-			lpb.logger.Info("start update handle")
+		for i := range updates {
+			update := &updates[i]
+			if update.UpdateID <= lastDispatched {
+				continue
+			}
+			lastDispatched = update.UpdateID
 
-			if err := lpb.uh.UpdateHandle(lpb.bot, &update); err != nil {
-				lpb.logger.Error("failed update handle", zap.Error(err))
-				return fmt.Errorf("error in update handler: %v", err)
+			if lpb.tooOld(update) {
+				lpb.logger.Info("skip old update", zap.Int("update_id", update.UpdateID))
+				lpb.offsets.Start(update.UpdateID)
+				lpb.offsets.Done(update.UpdateID)
+				continue
 			}
 
-			lpb.logger.Info("done update handle")
+			if err := dispatcher.Dispatch(ctx, update); err != nil {
+				return ctx.Err()
+			}
 		}
 	}
 }
+
+// getUpdates is bot.GetUpdates that returns when ctx is done; the request
+// itself is left to finish in the background.
+func (lpb *LongPollingBot) getUpdates(ctx context.Context, offset int) ([]tgbotapi.Update, error) {
+	config := tgbotapi.NewUpdate(offset)
+	config.Timeout = lpb.timeout
+
+	type result struct {
+		updates []tgbotapi.Update
+		err     error
+	}
+	results := make(chan result, 1)
+	go func() {
+		updates, err := lpb.bot.GetUpdates(config)
+		results <- result{updates, err}
+	}()
+
+	select {
+	case r := <-results:
+		return r.updates, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// tooOld reports whether the update is a message sent longer than
+// skipOlderThan ago, e.g. a backlog left from downtime.
+func (lpb *LongPollingBot) tooOld(update *tgbotapi.Update) bool {
+	if lpb.skipOlderThan <= 0 {
+		return false
+	}
+
+	var date int
+	switch {
+	case update.Message != nil:
+		date = update.Message.Date
+	case update.EditedMessage != nil:
+		date = update.EditedMessage.EditDate
+	case update.ChannelPost != nil:
+		date = update.ChannelPost.Date
+	default: // callbacks and others have no date of their own
+		return false
+	}
+
+	return date > 0 && time.Since(time.Unix(int64(date), 0)) > lpb.skipOlderThan
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,212 @@
+package botwork
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// fakeUpdates serves getUpdates like Telegram: updates below the requested
+// offset are confirmed and never returned again.
+type fakeUpdates struct {
+	mu      sync.Mutex
+	updates []tgbotapi.Update
+	offsets []int
+}
+
+func newFakeUpdatesBot(t *testing.T, updates []tgbotapi.Update) (*fakeUpdates, *tgbotapi.BotAPI) {
+	fake := &fakeUpdates{updates: updates}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if filepath.Base(r.URL.Path) == "getMe" {
+			_, _ = w.Write([]byte(`{"ok": true, "result": {"id": 1, "is_bot": true, "username": "test_bot"}}`))
+			return
+		}
+
+		offset, _ := strconv.Atoi(r.PostForm.Get("offset"))
+		result := fake.poll(offset)
+		if len(result) == 0 {
+			time.Sleep(5 * time.Millisecond) // the long poll timeout
+		}
+
+		data, _ := json.Marshal(result)
+		_, _ = w.Write([]byte(`{"ok": true, "result": ` + string(data) + `}`))
+	}))
+	t.Cleanup(server.Close)
+
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint("token", server.URL+"/bot%s/%s")
+	require.NoError(t, err)
+	return fake, bot
+}
+
+func (f *fakeUpdates) poll(offset int) []tgbotapi.Update {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.offsets = append(f.offsets, offset)
+	for len(f.updates) > 0 && f.updates[0].UpdateID < offset {
+		f.updates = f.updates[1:]
+	}
+	return append([]tgbotapi.Update(nil), f.updates...)
+}
+
+func messageUpdate(updateID int, chatID int64, sent time.Time) tgbotapi.Update {
+	return tgbotapi.Update{
+		UpdateID: updateID,
+		Message: &tgbotapi.Message{
+			Chat: &tgbotapi.Chat{ID: chatID},
+			Date: int(sent.Unix()),
+		},
+	}
+}
+
+func TestLongPollingCommitsHandledUpdates(t *testing.T) {
+	now := time.Now()
+	_, bot := newFakeUpdatesBot(t, []tgbotapi.Update{
+		messageUpdate(10, 1, now.Add(-time.Hour)),
+		messageUpdate(11, 1, now),
+		messageUpdate(12, 2, now),
+	})
+
+	handled := make(chan int, 3)
+	uh := handlerFunc(func(ctx context.Context, update *tgbotapi.Update) error {
+		handled <- update.UpdateID
+		return nil
+	})
+
+	path := filepath.Join(t.TempDir(), "offset")
+	offsets, err := NewOffsetTracker(zap.NewNop(), path)
+	require.NoError(t, err)
+
+	lpb := &LongPollingBot{
+		logger: zap.NewNop(), bot: bot, uh: uh,
+		concurrency: 2, gracePeriod: time.Second,
+		offsets: offsets, skipOlderThan: 10 * time.Minute,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- lpb.Start(ctx) }()
+
+	assert.ElementsMatch(t, []int{11, 12}, []int{<-handled, <-handled})
+	assert.Eventually(t, func() bool { return offsets.Committed() == 12 }, time.Second, time.Millisecond)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "12\n", string(data))
+}
+
+func TestLongPollingResumesFromSavedOffset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "offset")
+	require.NoError(t, os.WriteFile(path, []byte("11\n"), 0644))
+
+	now := time.Now()
+	fake, bot := newFakeUpdatesBot(t, []tgbotapi.Update{
+		messageUpdate(11, 1, now),
+		messageUpdate(12, 1, now),
+	})
+
+	handled := make(chan int, 2)
+	uh := handlerFunc(func(ctx context.Context, update *tgbotapi.Update) error {
+		handled <- update.UpdateID
+		return nil
+	})
+
+	offsets, err := NewOffsetTracker(zap.NewNop(), path)
+	require.NoError(t, err)
+	lpb := &LongPollingBot{logger: zap.NewNop(), bot: bot, uh: uh, concurrency: 1, gracePeriod: time.Second, offsets: offsets}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- lpb.Start(ctx) }()
+
+	assert.Equal(t, 12, <-handled)
+	cancel()
+	<-done
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	assert.Equal(t, 12, fake.offsets[0])
+	assert.Empty(t, handled)
+}
+
+func TestLongPollingDoesNotWaitForSlowUpdate(t *testing.T) {
+	now := time.Now()
+	fake, bot := newFakeUpdatesBot(t, []tgbotapi.Update{messageUpdate(10, 1, now)})
+
+	release := make(chan struct{})
+	handled := make(chan int, 2)
+	uh := handlerFunc(func(ctx context.Context, update *tgbotapi.Update) error {
+		if update.UpdateID == 10 {
+			<-release
+		}
+		handled <- update.UpdateID
+		return nil
+	})
+
+	offsets, err := NewOffsetTracker(zap.NewNop(), "")
+	require.NoError(t, err)
+	lpb := &LongPollingBot{logger: zap.NewNop(), bot: bot, uh: uh, concurrency: 2, gracePeriod: time.Second, offsets: offsets}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- lpb.Start(ctx) }()
+
+	assert.Eventually(t, func() bool {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		return len(fake.updates) == 0
+	}, time.Second, time.Millisecond, "update 10 is confirmed once dispatched")
+
+	fake.mu.Lock()
+	fake.updates = append(fake.updates, messageUpdate(11, 2, now))
+	fake.mu.Unlock()
+
+	select {
+	case id := <-handled:
+		assert.Equal(t, 11, id)
+	case <-time.After(2 * time.Second):
+		t.Fatal("update of another chat waits for the slow update")
+	}
+	assert.Less(t, offsets.Committed(), 10, "10 is still in flight")
+
+	close(release)
+	assert.Equal(t, 10, <-handled)
+	assert.Eventually(t, func() bool { return offsets.Committed() == 11 }, time.Second, time.Millisecond)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestOffsetTrackerCommitsContiguousPrefix(t *testing.T) {
+	offsets, err := NewOffsetTracker(zap.NewNop(), "")
+	require.NoError(t, err)
+
+	for id := 1; id <= 3; id++ {
+		offsets.Start(id)
+	}
+
+	offsets.Done(2)
+	assert.Equal(t, 0, offsets.Committed(), "1 is still in flight")
+
+	offsets.Done(1)
+	assert.Equal(t, 2, offsets.Committed())
+
+	offsets.Done(3)
+	assert.Equal(t, 3, offsets.Committed())
+}
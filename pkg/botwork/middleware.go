@@ -0,0 +1,179 @@
+package botwork
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+)
+
+// Logging logs the start, the result and the duration of every update.
+func Logging(logger *zap.Logger) Middleware {
+	return func(next UpdateHandler) UpdateHandler {
+		return HandlerFunc(func(ctx context.Context, bot *tgbotapi.BotAPI, update *tgbotapi.Update) error {
+			log := logger.With(
+				zap.Int("update_id", update.UpdateID),
+				zap.String("kind", UpdateKind(update)))
+			if chat := update.FromChat(); chat != nil {
+				log = log.With(zap.Int64("chat_id", chat.ID))
+			}
+
+			start := time.Now()
+			log.Debug("update received")
+
+			err := next.UpdateHandle(ctx, bot, update)
+			if err != nil {
+				log.Warn("update failed", zap.Duration("duration", time.Since(start)), zap.Error(err))
+				return err
+			}
+
+			log.Info("update handled", zap.Duration("duration", time.Since(start)))
+			return nil
+		})
+	}
+}
+
+// Recovery turns a panic of the handlers below into a *PanicError, so the
+// middleware above still sees the update finish.
+func Recovery() Middleware {
+	return func(next UpdateHandler) UpdateHandler {
+		return HandlerFunc(func(ctx context.Context, bot *tgbotapi.BotAPI, update *tgbotapi.Update) error {
+			return handleUpdate(ctx, next, bot, update)
+		})
+	}
+}
+
+// Auth passes on only updates allowed reports true for; the others are
+// dropped, or handed to denied when it is not nil.
+func Auth(allowed func(update *tgbotapi.Update) bool, denied UpdateHandler) Middleware {
+	return func(next UpdateHandler) UpdateHandler {
+		return HandlerFunc(func(ctx context.Context, bot *tgbotapi.BotAPI, update *tgbotapi.Update) error {
+			if allowed(update) {
+				return next.UpdateHandle(ctx, bot, update)
+			}
+			if denied != nil {
+				return denied.UpdateHandle(ctx, bot, update)
+			}
+			return nil
+		})
+	}
+}
+
+// AllowChats is an Auth check for a fixed set of chats. An empty set
+// allows every chat.
+func AllowChats(chatIDs []int64) func(update *tgbotapi.Update) bool {
+	allowed := make(map[int64]struct{}, len(chatIDs))
+	for _, id := range chatIDs {
+		allowed[id] = struct{}{}
+	}
+
+	return func(update *tgbotapi.Update) bool {
+		if len(allowed) == 0 {
+			return true
+		}
+		chat := update.FromChat()
+		if chat == nil {
+			return false
+		}
+		_, ok := allowed[chat.ID]
+		return ok
+	}
+}
+
+// Metrics reports the kind, duration and result of every update to observe.
+func Metrics(observe func(kind string, duration time.Duration, err error)) Middleware {
+	return func(next UpdateHandler) UpdateHandler {
+		return HandlerFunc(func(ctx context.Context, bot *tgbotapi.BotAPI, update *tgbotapi.Update) error {
+			start := time.Now()
+			err := next.UpdateHandle(ctx, bot, update)
+			observe(UpdateKind(update), time.Since(start), err)
+			return err
+		})
+	}
+}
+
+// RateLimit lets each chat through at most burst updates at once, refilled
+// at perMinute per minute. Updates over the limit are dropped, or handed to
+// limited when it is not nil. Updates without a chat are not limited.
+func RateLimit(perMinute, burst int, limited UpdateHandler) Middleware {
+	limiter := newChatLimiter(perMinute, burst)
+
+	return func(next UpdateHandler) UpdateHandler {
+		return HandlerFunc(func(ctx context.Context, bot *tgbotapi.BotAPI, update *tgbotapi.Update) error {
+			chat := update.FromChat()
+			if chat == nil || limiter.allow(chat.ID, time.Now()) {
+				return next.UpdateHandle(ctx, bot, update)
+			}
+			if limited != nil {
+				return limited.UpdateHandle(ctx, bot, update)
+			}
+			return nil
+		})
+	}
+}
+
+// chatLimiter is a token bucket per chat. Buckets that are full again are
+// forgotten once there are many of them.
+type chatLimiter struct {
+	interval time.Duration // time to refill one token
+	burst    float64
+
+	mu      sync.Mutex
+	buckets map[int64]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// maxIdleBuckets is the number of buckets after which full ones are removed.
+const maxIdleBuckets = 10000
+
+func newChatLimiter(perMinute, burst int) *chatLimiter {
+	if perMinute <= 0 {
+		perMinute = 1
+	}
+	if burst <= 0 {
+		burst = 1
+	}
+
+	return &chatLimiter{
+		interval: time.Minute / time.Duration(perMinute),
+		burst:    float64(burst),
+		buckets:  make(map[int64]*bucket),
+	}
+}
+
+func (l *chatLimiter) allow(chatID int64, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[chatID]
+	if !ok {
+		if len(l.buckets) >= maxIdleBuckets {
+			l.forgetFull(now)
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[chatID] = b
+	}
+
+	b.tokens = min(l.burst, b.tokens+float64(now.Sub(b.last))/float64(l.interval))
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (l *chatLimiter) forgetFull(now time.Time) {
+	for chatID, b := range l.buckets {
+		if b.tokens+float64(now.Sub(b.last))/float64(l.interval) >= l.burst {
+			delete(l.buckets, chatID)
+		}
+	}
+}
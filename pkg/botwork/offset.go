@@ -0,0 +1,112 @@
+package botwork
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// OffsetTracker follows which dispatched updates are fully handled. The
+// committed update ID is the highest one with every update up to it handled;
+// long polling resumes from it after a restart. With a path the committed ID
+// is saved to a file each time it advances.
+type OffsetTracker struct {
+	logger *zap.Logger
+	path   string
+
+	mu        sync.Mutex
+	inFlight  map[int]struct{}
+	started   int // highest started update ID
+	committed int
+}
+
+// NewOffsetTracker loads the committed update ID from path; an empty path
+// keeps it in memory only.
+func NewOffsetTracker(logger *zap.Logger, path string) (*OffsetTracker, error) {
+	t := &OffsetTracker{
+		logger:   logger.With(zap.String("component", "offset tracker")),
+		path:     path,
+		inFlight: make(map[int]struct{}),
+	}
+
+	if path != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, fmt.Errorf("error in creating offset store directory: %w", err)
+		}
+
+		data, err := os.ReadFile(path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return nil, fmt.Errorf("error in reading offset store: %w", err)
+		default:
+			committed, err := strconv.Atoi(strings.TrimSpace(string(data)))
+			if err != nil {
+				return nil, fmt.Errorf("error in parsing offset store %s: %w", path, err)
+			}
+			t.committed, t.started = committed, committed
+		}
+	}
+
+	t.logger.Info("offset tracker initialized",
+		zap.String("path", path),
+		zap.Int("committed", t.committed))
+	return t, nil
+}
+
+// Committed returns the last update ID handled together with all before it,
+// 0 when nothing is known.
+func (t *OffsetTracker) Committed() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.committed
+}
+
+// Start marks the update as being handled. Updates start in ID order.
+func (t *OffsetTracker) Start(updateID int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.inFlight[updateID] = struct{}{}
+	t.started = max(t.started, updateID)
+}
+
+// Done marks the update as handled, successfully or not.
+func (t *OffsetTracker) Done(updateID int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.inFlight, updateID)
+
+	committed := t.started
+	for id := range t.inFlight {
+		committed = min(committed, id-1)
+	}
+	if committed <= t.committed {
+		return
+	}
+
+	t.committed = committed
+
+	if err := t.save(); err != nil {
+		t.logger.Warn("failed to save offset", zap.Int("committed", committed), zap.Error(err))
+	}
+}
+
+func (t *OffsetTracker) save() error {
+	if t.path == "" {
+		return nil
+	}
+
+	tmpPath := t.path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(strconv.Itoa(t.committed)+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, t.path)
+}
@@ -0,0 +1,188 @@
+package botwork
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+)
+
+// Update kinds the Router dispatches by.
+const (
+	KindMessage       = "message"
+	KindEditedMessage = "edited_message"
+	KindCallbackQuery = "callback_query"
+	KindInlineQuery   = "inline_query"
+	KindChannelPost   = "channel_post"
+	KindMyChatMember  = "my_chat_member"
+	KindOther         = "other"
+)
+
+// HandlerFunc adapts a function to UpdateHandler.
+type HandlerFunc func(ctx context.Context, bot *tgbotapi.BotAPI, update *tgbotapi.Update) error
+
+func (f HandlerFunc) UpdateHandle(ctx context.Context, bot *tgbotapi.BotAPI, update *tgbotapi.Update) error {
+	return f(ctx, bot, update)
+}
+
+// Middleware wraps an UpdateHandler, e.g. to log, limit or reject updates.
+type Middleware func(next UpdateHandler) UpdateHandler
+
+// Router is an UpdateHandler that passes an update to the handler registered
+// for its kind; messages with a command go to the handler of that command
+// and callback queries to the handler of their data prefix first.
+// Middleware registered with Use wraps every handler, the first one being
+// the outermost. Updates without a handler are ignored.
+type Router struct {
+	logger *zap.Logger
+
+	middlewares []Middleware
+	handlers    map[string]UpdateHandler
+	commands    map[string]UpdateHandler
+	callbacks   map[string]UpdateHandler
+	outOfOrder  map[string]bool
+	initHooks   []func(ctx context.Context, bot *tgbotapi.BotAPI) error
+}
+
+func NewRouter(logger *zap.Logger) *Router {
+	return &Router{
+		logger:     logger.With(zap.String("component", "router")),
+		handlers:   make(map[string]UpdateHandler),
+		commands:   make(map[string]UpdateHandler),
+		callbacks:  make(map[string]UpdateHandler),
+		outOfOrder: make(map[string]bool),
+	}
+}
+
+func (r *Router) Use(middlewares ...Middleware) {
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+// Handle registers the handler for an update kind, see the Kind constants.
+func (r *Router) Handle(kind string, h UpdateHandler) {
+	r.handlers[kind] = h
+}
+
+// Command registers the handler for a command, given without the slash.
+func (r *Router) Command(name string, h UpdateHandler) {
+	r.commands[name] = h
+}
+
+// Callback registers the handler for callback queries with the data prefix,
+// see CallbackData.
+func (r *Router) Callback(prefix string, h UpdateHandler) {
+	r.callbacks[prefix] = h
+}
+
+func (r *Router) Message(h UpdateHandler)       { r.Handle(KindMessage, h) }
+func (r *Router) EditedMessage(h UpdateHandler) { r.Handle(KindEditedMessage, h) }
+func (r *Router) CallbackQuery(h UpdateHandler) { r.Handle(KindCallbackQuery, h) }
+func (r *Router) InlineQuery(h UpdateHandler)   { r.Handle(KindInlineQuery, h) }
+func (r *Router) ChannelPost(h UpdateHandler)   { r.Handle(KindChannelPost, h) }
+func (r *Router) MyChatMember(h UpdateHandler)  { r.Handle(KindMyChatMember, h) }
+
+// OutOfOrder makes the commands skip the queue of their chat, see
+// UnorderedUpdates.
+func (r *Router) OutOfOrder(names ...string) {
+	for _, name := range names {
+		r.outOfOrder[name] = true
+	}
+}
+
+// OnInit registers a hook the bot runs on start, see Initializer.
+func (r *Router) OnInit(hook func(ctx context.Context, bot *tgbotapi.BotAPI) error) {
+	r.initHooks = append(r.initHooks, hook)
+}
+
+func (r *Router) Init(ctx context.Context, bot *tgbotapi.BotAPI) error {
+	for _, hook := range r.initHooks {
+		if err := hook(ctx, bot); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unordered reports true for callback queries: a button press must be
+// answered before Telegram gives up on it, not after the transcription
+// running in its chat.
+func (r *Router) Unordered(update *tgbotapi.Update) bool {
+	if update.CallbackQuery != nil {
+		return true
+	}
+	return update.Message != nil && update.Message.IsCommand() && r.outOfOrder[update.Message.Command()]
+}
+
+// Commands returns the names of the registered commands.
+func (r *Router) Commands() []string {
+	names := make([]string, 0, len(r.commands))
+	for name := range r.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *Router) UpdateHandle(ctx context.Context, bot *tgbotapi.BotAPI, update *tgbotapi.Update) error {
+	h := r.route(bot, update)
+	if h == nil {
+		r.logger.Debug("no handler for update",
+			zap.Int("update_id", update.UpdateID),
+			zap.String("kind", UpdateKind(update)))
+		return nil
+	}
+
+	for i := len(r.middlewares) - 1; i >= 0; i-- {
+		h = r.middlewares[i](h)
+	}
+	return h.UpdateHandle(ctx, bot, update)
+}
+
+func (r *Router) route(bot *tgbotapi.BotAPI, update *tgbotapi.Update) UpdateHandler {
+	kind := UpdateKind(update)
+
+	if kind == KindMessage && update.Message.IsCommand() {
+		if !addressedToBot(bot, update.Message) {
+			return nil // a command for another bot in the group
+		}
+		if h, ok := r.commands[update.Message.Command()]; ok {
+			return h
+		}
+	}
+	if kind == KindCallbackQuery {
+		prefix, _, _ := strings.Cut(update.CallbackQuery.Data, ":")
+		if h, ok := r.callbacks[prefix]; ok {
+			return h
+		}
+	}
+
+	return r.handlers[kind]
+}
+
+// addressedToBot reports whether the command has no @mention or mentions
+// this bot.
+func addressedToBot(bot *tgbotapi.BotAPI, message *tgbotapi.Message) bool {
+	_, mention, ok := strings.Cut(message.CommandWithAt(), "@")
+	return !ok || bot == nil || mention == bot.Self.UserName
+}
+
+func UpdateKind(update *tgbotapi.Update) string {
+	switch {
+	case update.Message != nil:
+		return KindMessage
+	case update.EditedMessage != nil:
+		return KindEditedMessage
+	case update.CallbackQuery != nil:
+		return KindCallbackQuery
+	case update.InlineQuery != nil:
+		return KindInlineQuery
+	case update.ChannelPost != nil:
+		return KindChannelPost
+	case update.MyChatMember != nil:
+		return KindMyChatMember
+	default:
+		return KindOther
+	}
+}
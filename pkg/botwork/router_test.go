@@ -0,0 +1,191 @@
+package botwork
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func record(calls *[]string, name string) UpdateHandler {
+	return HandlerFunc(func(ctx context.Context, bot *tgbotapi.BotAPI, update *tgbotapi.Update) error {
+		*calls = append(*calls, name)
+		return nil
+	})
+}
+
+func commandUpdate(text string) *tgbotapi.Update {
+	return &tgbotapi.Update{Message: &tgbotapi.Message{
+		Text:     text,
+		Chat:     &tgbotapi.Chat{ID: 1},
+		Entities: []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(text)}},
+	}}
+}
+
+func TestRouterDispatchesByKindAndCommand(t *testing.T) {
+	var calls []string
+	r := NewRouter(zap.NewNop())
+	r.Message(record(&calls, "message"))
+	r.CallbackQuery(record(&calls, "callback"))
+	r.MyChatMember(record(&calls, "member"))
+	r.Command("start", record(&calls, "start"))
+	r.Callback("settings", record(&calls, "settings"))
+
+	updates := []*tgbotapi.Update{
+		{Message: &tgbotapi.Message{Text: "hi", Chat: &tgbotapi.Chat{ID: 1}}},
+		commandUpdate("/start"),
+		commandUpdate("/unknown"), // falls back to the message handler
+		{CallbackQuery: &tgbotapi.CallbackQuery{ID: "1"}},
+		{CallbackQuery: &tgbotapi.CallbackQuery{ID: "2", Data: "settings:1:lang:en"}},
+		{CallbackQuery: &tgbotapi.CallbackQuery{ID: "3", Data: "settingsx:1"}}, // not the prefix
+		{MyChatMember: &tgbotapi.ChatMemberUpdated{}},
+		{InlineQuery: &tgbotapi.InlineQuery{ID: "1"}}, // no handler
+	}
+	for _, update := range updates {
+		require.NoError(t, r.UpdateHandle(context.Background(), nil, update))
+	}
+
+	assert.Equal(t, []string{"message", "start", "message", "callback", "settings", "callback", "member"}, calls)
+	assert.Equal(t, []string{"start"}, r.Commands())
+}
+
+func TestRouterSkipsCommandsForOtherBots(t *testing.T) {
+	var calls []string
+	r := NewRouter(zap.NewNop())
+	r.Message(record(&calls, "message"))
+	r.Command("start", record(&calls, "start"))
+
+	bot := &tgbotapi.BotAPI{Self: tgbotapi.User{UserName: "vtt_bot"}}
+	require.NoError(t, r.UpdateHandle(context.Background(), bot, commandUpdate("/start@vtt_bot")))
+	require.NoError(t, r.UpdateHandle(context.Background(), bot, commandUpdate("/start@other_bot")))
+
+	assert.Equal(t, []string{"start"}, calls)
+}
+
+func TestRouterMiddlewareOrder(t *testing.T) {
+	var calls []string
+	named := func(name string) Middleware {
+		return func(next UpdateHandler) UpdateHandler {
+			return HandlerFunc(func(ctx context.Context, bot *tgbotapi.BotAPI, update *tgbotapi.Update) error {
+				calls = append(calls, name)
+				return next.UpdateHandle(ctx, bot, update)
+			})
+		}
+	}
+
+	r := NewRouter(zap.NewNop())
+	r.Use(named("first"), named("second"))
+	r.Message(record(&calls, "message"))
+
+	require.NoError(t, r.UpdateHandle(context.Background(), nil, chatUpdate(1, 1)))
+	assert.Equal(t, []string{"first", "second", "message"}, calls)
+}
+
+func TestMiddlewares(t *testing.T) {
+	var calls []string
+	var observed []string
+	failing := HandlerFunc(func(ctx context.Context, bot *tgbotapi.BotAPI, update *tgbotapi.Update) error {
+		if update.Message.Chat.ID == 3 {
+			panic("boom")
+		}
+		return errors.New("failed")
+	})
+
+	r := NewRouter(zap.NewNop())
+	r.Use(
+		Logging(zap.NewNop()),
+		Metrics(func(kind string, _ time.Duration, err error) {
+			observed = append(observed, fmt.Sprintf("%s: %v", kind, err))
+		}),
+		Recovery(),
+		Auth(AllowChats([]int64{1, 3}), record(&calls, "denied")),
+	)
+	r.Message(failing)
+
+	assert.Error(t, r.UpdateHandle(context.Background(), nil, chatUpdate(1, 1)))
+	require.NoError(t, r.UpdateHandle(context.Background(), nil, chatUpdate(2, 2)))
+
+	var panicErr *PanicError
+	assert.ErrorAs(t, r.UpdateHandle(context.Background(), nil, chatUpdate(3, 3)), &panicErr)
+
+	assert.Equal(t, []string{"denied"}, calls)
+	assert.Equal(t, []string{
+		"message: failed",
+		"message: <nil>",
+		"message: panic in update handler: boom",
+	}, observed)
+}
+
+func TestChatLimiter(t *testing.T) {
+	l := newChatLimiter(60, 2) // a token per second
+	now := time.Now()
+
+	assert.True(t, l.allow(1, now))
+	assert.True(t, l.allow(1, now))
+	assert.False(t, l.allow(1, now))
+	assert.True(t, l.allow(2, now), "chats are limited separately")
+
+	assert.False(t, l.allow(1, now.Add(500*time.Millisecond)))
+	assert.True(t, l.allow(1, now.Add(1500*time.Millisecond)))
+}
+
+func TestRouterOutOfOrderCommandSkipsChatQueue(t *testing.T) {
+	release := make(chan struct{})
+	canceled := make(chan struct{})
+
+	r := NewRouter(zap.NewNop())
+	r.Message(HandlerFunc(func(ctx context.Context, bot *tgbotapi.BotAPI, update *tgbotapi.Update) error {
+		<-release
+		return nil
+	}))
+	r.Command("cancel", HandlerFunc(func(ctx context.Context, bot *tgbotapi.BotAPI, update *tgbotapi.Update) error {
+		close(canceled)
+		return nil
+	}))
+	r.OutOfOrder("cancel")
+
+	cancel := commandUpdate("/cancel")
+	cancel.UpdateID = 2
+	assert.True(t, r.Unordered(cancel))
+	assert.False(t, r.Unordered(chatUpdate(1, 1)))
+
+	d := NewDispatcher(context.Background(), zap.NewNop(), nil, r, 2)
+	require.NoError(t, d.Dispatch(context.Background(), chatUpdate(1, 1)))
+	require.NoError(t, d.Dispatch(context.Background(), cancel))
+
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("/cancel waited for the earlier update of its chat")
+	}
+
+	close(release)
+	d.Shutdown(time.Second)
+}
+
+func TestRouterInitRunsHooks(t *testing.T) {
+	var calls []string
+	r := NewRouter(zap.NewNop())
+	r.OnInit(func(ctx context.Context, bot *tgbotapi.BotAPI) error {
+		calls = append(calls, "first")
+		return nil
+	})
+	r.OnInit(func(ctx context.Context, bot *tgbotapi.BotAPI) error {
+		calls = append(calls, "second")
+		return errors.New("failed")
+	})
+	r.OnInit(func(ctx context.Context, bot *tgbotapi.BotAPI) error {
+		calls = append(calls, "third")
+		return nil
+	})
+
+	err := initHandler(context.Background(), r, nil)
+	assert.ErrorContains(t, err, "failed")
+	assert.Equal(t, []string{"first", "second"}, calls)
+}
@@ -3,17 +3,21 @@ package botwork
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"go.uber.org/zap"
 )
 
-func RunOnWebHook(ctx context.Context, logger *zap.Logger, name string, apiToken, listenAddr string, uh UpdateHandler, debug bool) error {
+func RunOnWebHook(ctx context.Context, logger *zap.Logger, name string, apiToken, listenAddr string, uh UpdateHandler, debug bool, concurrency int, gracePeriod time.Duration, opts WebhookOptions, dedup *Deduplicator) error {
 	logger.Info("initializing webhook bot",
 		zap.String("listen_addr", listenAddr),
 		zap.Bool("debug", debug),
+		zap.Int("concurrency", concurrency),
+		zap.Duration("grace_period", gracePeriod),
+		zap.String("public_url", opts.PublicURL),
 	)
 
-	bot, err := NewWebHookBot(logger, name, apiToken, uh, debug)
+	bot, err := NewWebHookBot(logger, name, apiToken, uh, debug, concurrency, gracePeriod, opts, dedup)
 	if err != nil {
 		logger.Error("failed to initialize webhook bot", zap.Error(err))
 		return fmt.Errorf("error in bot init: %w", err)
@@ -33,14 +37,16 @@ func RunOnWebHook(ctx context.Context, logger *zap.Logger, name string, apiToken
 	return nil
 }
 
-func RunOnLongPolling(ctx context.Context, logger *zap.Logger, name string, apiToken, listenAddr string, uh UpdateHandler, timeout int, debug bool) error {
+func RunOnLongPolling(ctx context.Context, logger *zap.Logger, name string, apiToken, listenAddr string, uh UpdateHandler, timeout int, debug bool, concurrency int, gracePeriod time.Duration, dedup *Deduplicator, offsets *OffsetTracker, skipOlderThan time.Duration) error {
 	logger.Info("initializing long-polling bot",
 		zap.String("listen_addr", listenAddr),
 		zap.Int("timeout", timeout),
 		zap.Bool("debug", debug),
+		zap.Int("concurrency", concurrency),
+		zap.Duration("grace_period", gracePeriod),
 	)
 
-	bot, err := NewLongPollingBot(logger, name, apiToken, uh, timeout, debug)
+	bot, err := NewLongPollingBot(logger, name, apiToken, uh, timeout, debug, concurrency, gracePeriod, dedup, offsets, skipOlderThan)
 	if err != nil {
 		logger.Error("failed to initialize long-polling bot", zap.Error(err))
 		return fmt.Errorf("error in bot init: %w", err)
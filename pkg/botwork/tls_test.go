@@ -0,0 +1,70 @@
+package botwork
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func leaf(t *testing.T, r *certReloader) *x509.Certificate {
+	cert, err := r.GetCertificate(nil)
+	require.NoError(t, err)
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return parsed
+}
+
+func TestSelfSignedCertAndReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	require.NoError(t, ensureSelfSignedCert(zap.NewNop(), certFile, keyFile, "bot.example.com"))
+	r, err := newCertReloader(zap.NewNop(), certFile, keyFile)
+	require.NoError(t, err)
+
+	first := leaf(t, r)
+	assert.Equal(t, []string{"bot.example.com"}, first.DNSNames)
+
+	changed, err := r.reload()
+	require.NoError(t, err)
+	assert.False(t, changed, "files did not change")
+
+	// an existing certificate is kept
+	require.NoError(t, ensureSelfSignedCert(zap.NewNop(), certFile, keyFile, "other.example.com"))
+	assert.Equal(t, first.SerialNumber, leaf(t, r).SerialNumber)
+
+	// a renewed pair replaces the served one
+	require.NoError(t, os.Remove(certFile))
+	require.NoError(t, ensureSelfSignedCert(zap.NewNop(), certFile, keyFile, "203.0.113.7"))
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+
+	changed, err = r.reload()
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "203.0.113.7", leaf(t, r).IPAddresses[0].String())
+}
+
+func TestCertReloaderKeepsPreviousOnBrokenFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	require.NoError(t, ensureSelfSignedCert(zap.NewNop(), certFile, keyFile, "bot.example.com"))
+	r, err := newCertReloader(zap.NewNop(), certFile, keyFile)
+	require.NoError(t, err)
+	serial := leaf(t, r).SerialNumber
+
+	require.NoError(t, os.WriteFile(certFile, []byte("broken"), 0644))
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+
+	_, err = r.reload()
+	assert.Error(t, err)
+	assert.Equal(t, serial, leaf(t, r).SerialNumber)
+}
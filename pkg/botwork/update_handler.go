@@ -1,9 +1,35 @@
 package botwork
 
 import (
+	"context"
+	"fmt"
+
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 type UpdateHandler interface {
-	UpdateHandle(bot *tgbotapi.BotAPI, update *tgbotapi.Update) error
+	UpdateHandle(ctx context.Context, bot *tgbotapi.BotAPI, update *tgbotapi.Update) error
+}
+
+// Initializer is implemented by update handlers that need the bot before
+// the first update, e.g. to register commands. Bots call Init on start and
+// do not start when it fails.
+type Initializer interface {
+	Init(ctx context.Context, bot *tgbotapi.BotAPI) error
+}
+
+// UnorderedUpdates is implemented by update handlers some updates of which
+// must not wait for the earlier updates of their chat, e.g. a command that
+// cancels them.
+type UnorderedUpdates interface {
+	Unordered(update *tgbotapi.Update) bool
+}
+
+func initHandler(ctx context.Context, uh UpdateHandler, bot *tgbotapi.BotAPI) error {
+	if init, ok := uh.(Initializer); ok {
+		if err := init.Init(ctx, bot); err != nil {
+			return fmt.Errorf("error in update handler init: %w", err)
+		}
+	}
+	return nil
 }
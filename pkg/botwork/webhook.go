@@ -2,7 +2,9 @@ package botwork
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -24,9 +26,14 @@ type WebHookBot struct {
 
 	bot *tgbotapi.BotAPI
 	uh  UpdateHandler
+
+	concurrency int
+	gracePeriod time.Duration
+	opts        WebhookOptions
+	dedup       *Deduplicator
 }
 
-func NewWebHookBot(logger *zap.Logger, name string, apiToken string, uh UpdateHandler, debug bool) (*WebHookBot, error) {
+func NewWebHookBot(logger *zap.Logger, name string, apiToken string, uh UpdateHandler, debug bool, concurrency int, gracePeriod time.Duration, opts WebhookOptions, dedup *Deduplicator) (*WebHookBot, error) {
 	bot, err := tgbotapi.NewBotAPI(apiToken)
 	if err != nil {
 		return nil, err
@@ -35,49 +42,143 @@ func NewWebHookBot(logger *zap.Logger, name string, apiToken string, uh UpdateHa
 	bot.Debug = debug
 
 	logger = logger.With(zap.String("name", name))
-	logger.Info("create new webhook bot")
+	logger.Info("create new webhook bot",
+		zap.Int("concurrency", concurrency),
+		zap.Duration("grace_period", gracePeriod))
 
 	return &WebHookBot{
 		name:   name,
 		logger: logger,
 		bot:    bot,
 		uh:     uh,
+
+		concurrency: concurrency,
+		gracePeriod: gracePeriod,
+		opts:        opts,
+		dedup:       dedup,
 	}, nil
 }
 
 func (w *WebHookBot) Start(ctx context.Context, listenAddr string) error {
+	if err := initHandler(ctx, w.uh, w.bot); err != nil {
+		w.logger.Error("failed to init update handler", zap.Error(err))
+		return err
+	}
+
+	certs, err := w.prepareTLS()
+	if err != nil {
+		w.logger.Error("failed to prepare TLS", zap.Error(err))
+		return err
+	}
+
+	if err := w.registerWebhook(); err != nil {
+		w.logger.Error("failed to register webhook", zap.Error(err))
+		return err
+	}
+	defer w.deleteWebhook()
+
+	dispatcher := NewDispatcher(ctx, w.logger, w.bot, w.uh, w.concurrency)
+	if w.dedup != nil {
+		dispatcher.SetDeduplicator(w.dedup)
+	}
+
 	mux := http.NewServeMux()
-	mux.Handle("/webhook", w.loggingMiddleware(http.HandlerFunc(w.newWebhookHandler())))
+	mux.Handle("/webhook", w.loggingMiddleware(w.secretTokenMiddleware(http.HandlerFunc(w.newWebhookHandler(dispatcher)))))
 
 	server := &http.Server{
 		Addr:    listenAddr,
 		Handler: mux,
 	}
 
+	if certs != nil {
+		server.TLSConfig = &tls.Config{
+			GetCertificate: certs.GetCertificate,
+			MinVersion:     tls.VersionTLS12,
+		}
+
+		watchCtx, stopWatch := context.WithCancel(ctx)
+		defer stopWatch()
+		go certs.watch(watchCtx, certReloadInterval, w.onCertReload)
+	}
+
 	errChan := make(chan error, 1)
 	go func() {
-		w.logger.Info("start server for webhooks")
+		w.logger.Info("start server for webhooks", zap.Bool("tls", certs != nil))
 
-		if err := server.ListenAndServe(); err != nil {
+		var err error
+		if certs != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil {
 			w.logger.Error("error starting HTTP server", zap.Error(err))
 			errChan <- fmt.Errorf("error starting HTTP server: %v", err)
 		}
 	}()
 
+	var stopErr error
 	select {
 	case <-ctx.Done():
 		w.logger.Warn("contex done (timeout/context canceled/...)", zap.Error(ctx.Err()))
+	case err := <-dispatcher.Err():
+		w.logger.Error("stop bot on fatal error", zap.Error(err))
+		stopErr = fmt.Errorf("error in update handler: %w", err)
 	case err := <-errChan:
-		return err
+		stopErr = err
 	}
 
 	w.logger.Info("try shutdown server")
+	if err := server.Shutdown(context.Background()); err != nil && stopErr == nil {
+		stopErr = err
+	}
+	w.logger.Info("shutdown server")
+
+	// the server no longer accepts updates, finish the accepted ones
+	w.logger.Info("draining update handlers")
+	dispatcher.Shutdown(w.gracePeriod)
 
-	defer w.logger.Info("shutdown server")
-	return server.Shutdown(context.Background())
+	stats := dispatcher.Stats()
+	w.logger.Info("bot stopped",
+		zap.Int64("handled", stats.Handled),
+		zap.Int64("failed", stats.Failed),
+		zap.Int64("panicked", stats.Panicked),
+		zap.Int64("duplicates", stats.Duplicates))
+
+	return stopErr
 }
 
-func (e *WebHookBot) newWebhookHandler() func(http.ResponseWriter, *http.Request) {
+// prepareTLS loads the certificate when the bot terminates TLS itself.
+func (w *WebHookBot) prepareTLS() (*certReloader, error) {
+	if !w.opts.tlsEnabled() {
+		return nil, nil
+	}
+
+	if w.opts.SelfSigned {
+		host, err := w.opts.publicHost()
+		if err != nil {
+			return nil, err
+		}
+		if err := ensureSelfSignedCert(w.logger, w.opts.TLSCertFile, w.opts.TLSKeyFile, host); err != nil {
+			return nil, fmt.Errorf("error in self-signed certificate: %w", err)
+		}
+	}
+
+	return newCertReloader(w.logger, w.opts.TLSCertFile, w.opts.TLSKeyFile)
+}
+
+// onCertReload uploads a changed self-signed certificate, Telegram would not
+// trust it otherwise.
+func (w *WebHookBot) onCertReload() {
+	if !w.opts.SelfSigned {
+		return
+	}
+	if err := w.registerWebhook(); err != nil {
+		w.logger.Error("failed to register webhook with the new certificate", zap.Error(err))
+	}
+}
+
+func (e *WebHookBot) newWebhookHandler(dispatcher *Dispatcher) func(http.ResponseWriter, *http.Request) {
 	logger := e.logger.With(zap.String("component", "webhook handler"))
 
 	handler := func(w http.ResponseWriter, r *http.Request) {
@@ -105,13 +206,19 @@ func (e *WebHookBot) newWebhookHandler() func(http.ResponseWriter, *http.Request
 		}
 		defer utils.CloserErrorHandle(logger, r.Body, "error closing body")
 
-		go func() {
-			logger.Info("start update handler")
-			if err := e.uh.UpdateHandle(e.bot, &update); err != nil {
-				logger.Error("error in one update handler", zap.Error(err))
+		// Telegram redelivers the update when the answer is not 2xx
+		if err := dispatcher.TryDispatch(&update); err != nil {
+			if errors.Is(err, ErrSaturated) {
+				logger.Warn("too many updates in progress, asking to retry",
+					zap.Int("update_id", update.UpdateID))
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
 			}
-			logger.Info("finish update handler")
-		}()
+			logger.Error("error dispatching update", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 	}
 
 	return handler
@@ -0,0 +1,137 @@
+package botwork
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+)
+
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// WebhookOptions configure how the bot registers its webhook in Telegram.
+// With an empty PublicURL the webhook is expected to be set by hand.
+type WebhookOptions struct {
+	PublicURL          string // the URL Telegram posts updates to, must reach /webhook on the listen address
+	SecretToken        string // generated on start when empty and PublicURL is set
+	AllowedUpdates     []string
+	MaxConnections     int
+	DropPendingUpdates bool
+	DeleteOnShutdown   bool
+
+	// TLS is served by the bot itself when both files are set.
+	TLSCertFile string
+	TLSKeyFile  string
+	// SelfSigned uploads the certificate in setWebhook so that Telegram
+	// trusts it; a missing certificate is generated for the PublicURL host.
+	SelfSigned bool
+}
+
+func (o WebhookOptions) tlsEnabled() bool {
+	return o.TLSCertFile != "" && o.TLSKeyFile != ""
+}
+
+func (o WebhookOptions) publicHost() (string, error) {
+	u, err := url.Parse(o.PublicURL)
+	if err != nil {
+		return "", fmt.Errorf("error in parsing webhook public url: %w", err)
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("webhook public url has no host: %q", o.PublicURL)
+	}
+	return u.Hostname(), nil
+}
+
+// registerWebhook calls setWebhook, uploading a self-signed certificate.
+// tgbotapi.WebhookConfig has no secret_token, so the request is made by hand.
+func (w *WebHookBot) registerWebhook() error {
+	if w.opts.PublicURL == "" {
+		w.logger.Info("webhook public url is not set, skip setWebhook")
+		return nil
+	}
+
+	if w.opts.SecretToken == "" {
+		token, err := newSecretToken()
+		if err != nil {
+			return fmt.Errorf("error in generating secret token: %w", err)
+		}
+		w.opts.SecretToken = token
+	}
+
+	params := tgbotapi.Params{"url": w.opts.PublicURL}
+	params.AddNonEmpty("secret_token", w.opts.SecretToken)
+	params.AddNonZero("max_connections", w.opts.MaxConnections)
+	params.AddBool("drop_pending_updates", w.opts.DropPendingUpdates)
+	if len(w.opts.AllowedUpdates) > 0 {
+		if err := params.AddInterface("allowed_updates", w.opts.AllowedUpdates); err != nil {
+			return fmt.Errorf("error in encoding allowed updates: %w", err)
+		}
+	}
+
+	var err error
+	if w.opts.SelfSigned && w.opts.tlsEnabled() {
+		_, err = w.bot.UploadFiles("setWebhook", params, []tgbotapi.RequestFile{{
+			Name: "certificate",
+			Data: tgbotapi.FilePath(w.opts.TLSCertFile),
+		}})
+	} else {
+		_, err = w.bot.MakeRequest("setWebhook", params)
+	}
+	if err != nil {
+		return fmt.Errorf("error in setWebhook: %w", err)
+	}
+
+	w.logger.Info("webhook registered",
+		zap.Bool("self_signed", w.opts.SelfSigned && w.opts.tlsEnabled()),
+		zap.String("url", w.opts.PublicURL),
+		zap.Strings("allowed_updates", w.opts.AllowedUpdates),
+		zap.Int("max_connections", w.opts.MaxConnections),
+		zap.Bool("drop_pending_updates", w.opts.DropPendingUpdates))
+	return nil
+}
+
+func (w *WebHookBot) deleteWebhook() {
+	if w.opts.PublicURL == "" || !w.opts.DeleteOnShutdown {
+		return
+	}
+
+	if _, err := w.bot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		w.logger.Error("error in deleteWebhook", zap.Error(err))
+		return
+	}
+	w.logger.Info("webhook deleted")
+}
+
+// secretTokenMiddleware rejects requests without the secret token Telegram
+// was given in setWebhook.
+func (w *WebHookBot) secretTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if w.opts.SecretToken == "" {
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		token := r.Header.Get(secretTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(w.opts.SecretToken)) != 1 {
+			w.logger.Warn("webhook request with wrong secret token",
+				zap.String("remote_addr", r.RemoteAddr))
+			http.Error(rw, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+func newSecretToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
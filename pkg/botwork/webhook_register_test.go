@@ -0,0 +1,141 @@
+package botwork
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// fakeTelegram answers Bot API methods with ok and remembers their params.
+type fakeTelegram struct {
+	mu    sync.Mutex
+	calls map[string]map[string]string
+}
+
+func newFakeTelegram(t *testing.T) (*fakeTelegram, *tgbotapi.BotAPI) {
+	fake := &fakeTelegram{calls: map[string]map[string]string{}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseMultipartForm(1 << 20) // parses url-encoded forms too
+		method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+
+		params := map[string]string{}
+		for key := range r.PostForm {
+			params[key] = r.PostForm.Get(key)
+		}
+		if r.MultipartForm != nil {
+			for key := range r.MultipartForm.File {
+				params[key] = "<file>"
+			}
+		}
+
+		fake.mu.Lock()
+		fake.calls[method] = params
+		fake.mu.Unlock()
+
+		if method == "getMe" {
+			_, _ = w.Write([]byte(`{"ok": true, "result": {"id": 1, "is_bot": true, "username": "test_bot"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok": true, "result": true}`))
+	}))
+	t.Cleanup(server.Close)
+
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint("token", server.URL+"/bot%s/%s")
+	require.NoError(t, err)
+	return fake, bot
+}
+
+func (f *fakeTelegram) call(method string) (map[string]string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	params, ok := f.calls[method]
+	return params, ok
+}
+
+func TestRegisterWebhook(t *testing.T) {
+	fake, bot := newFakeTelegram(t)
+	w := &WebHookBot{logger: zap.NewNop(), bot: bot, opts: WebhookOptions{
+		PublicURL:          "https://bot.example.com/webhook",
+		AllowedUpdates:     []string{"message", "callback_query"},
+		MaxConnections:     10,
+		DropPendingUpdates: true,
+		DeleteOnShutdown:   true,
+	}}
+
+	require.NoError(t, w.registerWebhook())
+
+	params, ok := fake.call("setWebhook")
+	require.True(t, ok)
+	assert.Equal(t, "https://bot.example.com/webhook", params["url"])
+	assert.Equal(t, `["message","callback_query"]`, params["allowed_updates"])
+	assert.Equal(t, "10", params["max_connections"])
+	assert.Equal(t, "true", params["drop_pending_updates"])
+	assert.Len(t, params["secret_token"], 64, "generated when not configured")
+	assert.Equal(t, w.opts.SecretToken, params["secret_token"])
+
+	w.deleteWebhook()
+	_, ok = fake.call("deleteWebhook")
+	assert.True(t, ok)
+}
+
+func TestRegisterWebhookWithoutPublicURL(t *testing.T) {
+	fake, bot := newFakeTelegram(t)
+	w := &WebHookBot{logger: zap.NewNop(), bot: bot, opts: WebhookOptions{DeleteOnShutdown: true}}
+
+	require.NoError(t, w.registerWebhook())
+	w.deleteWebhook()
+
+	_, ok := fake.call("setWebhook")
+	assert.False(t, ok)
+	_, ok = fake.call("deleteWebhook")
+	assert.False(t, ok)
+}
+
+func TestSecretTokenMiddleware(t *testing.T) {
+	w := &WebHookBot{logger: zap.NewNop(), opts: WebhookOptions{SecretToken: "secret"}}
+	handler := w.secretTokenMiddleware(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+
+	for token, code := range map[string]int{
+		"secret": http.StatusOK,
+		"wrong":  http.StatusUnauthorized,
+		"":       http.StatusUnauthorized,
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/webhook", nil)
+		if token != "" {
+			r.Header.Set(secretTokenHeader, token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		assert.Equal(t, code, rec.Code, "token %q", token)
+	}
+}
+
+func TestRegisterWebhookUploadsSelfSignedCert(t *testing.T) {
+	fake, bot := newFakeTelegram(t)
+	dir := t.TempDir()
+	w := &WebHookBot{logger: zap.NewNop(), bot: bot, opts: WebhookOptions{
+		PublicURL:   "https://203.0.113.7:8443/webhook",
+		SecretToken: "secret",
+		TLSCertFile: filepath.Join(dir, "cert.pem"),
+		TLSKeyFile:  filepath.Join(dir, "key.pem"),
+		SelfSigned:  true,
+	}}
+
+	certs, err := w.prepareTLS()
+	require.NoError(t, err)
+	require.NotNil(t, certs)
+	require.NoError(t, w.registerWebhook())
+
+	params, ok := fake.call("setWebhook")
+	require.True(t, ok)
+	assert.Equal(t, "<file>", params["certificate"])
+	assert.Equal(t, "secret", params["secret_token"])
+}
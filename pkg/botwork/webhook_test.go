@@ -0,0 +1,45 @@
+package botwork
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func postUpdate(handler http.HandlerFunc, updateID int) int {
+	body := fmt.Sprintf(`{"update_id": %d, "message": {"message_id": 1, "chat": {"id": %d}}}`, updateID, updateID)
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body)))
+	return rec.Code
+}
+
+func TestWebhookAnswersServiceUnavailableWhenSaturated(t *testing.T) {
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+	uh := handlerFunc(func(ctx context.Context, update *tgbotapi.Update) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+
+	w := &WebHookBot{logger: zap.NewNop(), uh: uh}
+	dispatcher := NewDispatcher(context.Background(), zap.NewNop(), nil, uh, 1)
+	handler := w.newWebhookHandler(dispatcher)
+
+	assert.Equal(t, http.StatusOK, postUpdate(handler, 1))
+	<-started
+	assert.Equal(t, http.StatusOK, postUpdate(handler, 2)) // waits for the running one
+	assert.Equal(t, http.StatusServiceUnavailable, postUpdate(handler, 3))
+
+	close(release)
+	dispatcher.Shutdown(time.Second)
+	assert.Equal(t, DispatcherStats{Handled: 2}, dispatcher.Stats())
+}
@@ -0,0 +1,282 @@
+package breaker
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+type Config struct {
+	Window           time.Duration // sliding window for error rate and latency
+	MinRequests      int           // calls in the window before the breaker may trip
+	ErrorRate        float64       // trip when failed/total reaches it
+	SlowCallDuration time.Duration // calls slower than this are slow, 0 disables
+	SlowCallRate     float64       // trip when slow/total reaches it, 0 disables
+	OpenTimeout      time.Duration // time in open state before a trial call
+	HalfOpenProbes   int           // successful trial calls needed to close
+}
+
+type outcome struct {
+	at     time.Time
+	failed bool
+	slow   bool
+}
+
+type breaker struct {
+	state     State
+	window    []outcome
+	successes int           // in half-open
+	probing   bool          // a half-open trial call is in flight
+	ready     chan struct{} // closed while calls are allowed
+	timer     *time.Timer
+}
+
+// Set keeps one breaker per target (worker URL).
+type Set struct {
+	logger *zap.Logger
+	cfg    Config
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+func NewSet(logger *zap.Logger, cfg Config, targets []string) *Set {
+	if cfg.MinRequests < 1 {
+		cfg.MinRequests = 1
+	}
+	if cfg.HalfOpenProbes < 1 {
+		cfg.HalfOpenProbes = 1
+	}
+
+	s := &Set{
+		logger:   logger.Named("breaker"),
+		cfg:      cfg,
+		breakers: make(map[string]*breaker, len(targets)),
+	}
+
+	for _, target := range targets {
+		ready := make(chan struct{})
+		close(ready)
+		s.breakers[target] = &breaker{state: Closed, ready: ready}
+	}
+
+	return s
+}
+
+// Ready returns a channel that is closed while target accepts calls: in
+// closed state, or in half-open state with no trial call in flight. Unknown
+// targets are always ready.
+func (s *Set) Ready(target string) <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b, ok := s.breakers[target]; ok {
+		return b.ready
+	}
+
+	ready := make(chan struct{})
+	close(ready)
+	return ready
+}
+
+// Allow must be called before each call to target. In half-open state it
+// lets a single trial call through and rejects the rest until the outcome
+// of that call is recorded.
+func (s *Set) Allow(target string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.breakers[target]
+	if !ok {
+		return true
+	}
+
+	switch b.state {
+	case Closed:
+		return true
+	case HalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		b.ready = make(chan struct{})
+		return true
+	default:
+		return false
+	}
+}
+
+// Release ends an allowed call whose outcome is not recorded, so that the
+// trial call it may hold is given to another caller.
+func (s *Set) Release(target string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b, ok := s.breakers[target]; ok && b.state == HalfOpen && b.probing {
+		b.probing = false
+		close(b.ready)
+	}
+}
+
+func (s *Set) Available(target string) bool {
+	return s.State(target) != Open
+}
+
+func (s *Set) State(target string) State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b, ok := s.breakers[target]; ok {
+		return b.state
+	}
+	return Closed
+}
+
+func (s *Set) States() map[string]State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states := make(map[string]State, len(s.breakers))
+	for target, b := range s.breakers {
+		states[target] = b.state
+	}
+	return states
+}
+
+// Record reports the outcome of one call to target.
+func (s *Set) Record(target string, failed bool, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.breakers[target]
+	if !ok {
+		return
+	}
+
+	slow := s.cfg.SlowCallDuration > 0 && latency > s.cfg.SlowCallDuration
+
+	switch b.state {
+	case Open:
+		// a call that was already in flight when the breaker opened
+
+	case HalfOpen:
+		if !b.probing {
+			return // a call that was already in flight when the breaker opened
+		}
+		if failed || slow {
+			s.trip(target, b)
+			return
+		}
+		b.successes++
+		if b.successes >= s.cfg.HalfOpenProbes {
+			s.setState(target, b, Closed)
+			b.window = b.window[:0]
+			return
+		}
+		b.probing = false
+		close(b.ready)
+
+	case Closed:
+		now := time.Now()
+		b.window = append(b.window, outcome{at: now, failed: failed, slow: slow})
+		b.window = prune(b.window, now.Add(-s.cfg.Window))
+
+		if s.shouldTrip(b.window) {
+			s.trip(target, b)
+		}
+	}
+}
+
+func (s *Set) shouldTrip(window []outcome) bool {
+	if len(window) < s.cfg.MinRequests {
+		return false
+	}
+
+	var failed, slow int
+	for _, o := range window {
+		if o.failed {
+			failed++
+		}
+		if o.slow {
+			slow++
+		}
+	}
+
+	total := float64(len(window))
+	if s.cfg.ErrorRate > 0 && float64(failed)/total >= s.cfg.ErrorRate {
+		return true
+	}
+	return s.cfg.SlowCallRate > 0 && float64(slow)/total >= s.cfg.SlowCallRate
+}
+
+func (s *Set) trip(target string, b *breaker) {
+	s.setState(target, b, Open)
+	b.window = b.window[:0]
+
+	b.timer = time.AfterFunc(s.cfg.OpenTimeout, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if b.state == Open {
+			s.setState(target, b, HalfOpen)
+		}
+	})
+}
+
+func (s *Set) setState(target string, b *breaker, state State) {
+	from := b.state
+	blocked := from == Open || b.probing
+	b.state = state
+	b.successes = 0
+	b.probing = false
+
+	switch state {
+	case Open:
+		if !blocked {
+			b.ready = make(chan struct{})
+		}
+	case Closed, HalfOpen:
+		if blocked {
+			close(b.ready)
+		}
+	}
+	if state != Open && b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+
+	s.logger.Warn("circuit breaker state changed",
+		zap.String("target", target),
+		zap.Stringer("from", from),
+		zap.Stringer("to", state))
+}
+
+func prune(window []outcome, since time.Time) []outcome {
+	i := 0
+	for i < len(window) && window[i].at.Before(since) {
+		i++
+	}
+	return window[i:]
+}
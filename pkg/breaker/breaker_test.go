@@ -0,0 +1,115 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func testConfig() Config {
+	return Config{
+		Window:           time.Minute,
+		MinRequests:      4,
+		ErrorRate:        0.5,
+		SlowCallDuration: time.Second,
+		SlowCallRate:     0.75,
+		OpenTimeout:      20 * time.Millisecond,
+		HalfOpenProbes:   1,
+	}
+}
+
+func TestTripsOnErrorRate(t *testing.T) {
+	s := NewSet(zap.NewNop(), testConfig(), []string{"a"})
+
+	s.Record("a", true, 0)
+	s.Record("a", false, 0)
+	s.Record("a", true, 0)
+	assert.Equal(t, Closed, s.State("a"), "below min requests")
+
+	s.Record("a", false, 0)
+	assert.Equal(t, Open, s.State("a"))
+	assert.False(t, s.Available("a"))
+
+	select {
+	case <-s.Ready("a"):
+		t.Fatal("open breaker must not be ready")
+	default:
+	}
+}
+
+func TestTripsOnSlowCalls(t *testing.T) {
+	s := NewSet(zap.NewNop(), testConfig(), []string{"a"})
+
+	for range 3 {
+		s.Record("a", false, 2*time.Second)
+	}
+	s.Record("a", false, 0)
+
+	assert.Equal(t, Open, s.State("a"))
+}
+
+func TestHalfOpenRecovery(t *testing.T) {
+	s := NewSet(zap.NewNop(), testConfig(), []string{"a"})
+	for range 4 {
+		s.Record("a", true, 0)
+	}
+	ready := s.Ready("a")
+
+	select {
+	case <-ready:
+	case <-time.After(time.Second):
+		t.Fatal("breaker did not become half-open")
+	}
+	assert.Equal(t, HalfOpen, s.State("a"))
+
+	assert.True(t, s.Allow("a"))
+	s.Record("a", true, 0)
+	assert.Equal(t, Open, s.State("a"), "failed trial call reopens the breaker")
+	assert.False(t, s.Allow("a"))
+
+	assert.Eventually(t, func() bool { return s.State("a") == HalfOpen }, time.Second, time.Millisecond)
+	assert.True(t, s.Allow("a"))
+	s.Record("a", false, 0)
+	assert.Equal(t, Closed, s.State("a"))
+	assert.True(t, isReady(s.Ready("a")))
+}
+
+func TestHalfOpenSingleProbe(t *testing.T) {
+	cfg := testConfig()
+	cfg.HalfOpenProbes = 2
+	s := NewSet(zap.NewNop(), cfg, []string{"a"})
+	for range 4 {
+		s.Record("a", true, 0)
+	}
+	assert.Eventually(t, func() bool { return s.State("a") == HalfOpen }, time.Second, time.Millisecond)
+	assert.True(t, isReady(s.Ready("a")))
+
+	assert.True(t, s.Allow("a"))
+	assert.False(t, s.Allow("a"), "one trial call at a time")
+	assert.False(t, isReady(s.Ready("a")))
+
+	s.Record("a", false, 0)
+	assert.Equal(t, HalfOpen, s.State("a"), "more trial calls needed")
+	assert.True(t, isReady(s.Ready("a")))
+
+	assert.True(t, s.Allow("a"))
+	s.Release("a") // the caller gave up, the trial call goes to another one
+	assert.True(t, isReady(s.Ready("a")))
+
+	assert.True(t, s.Allow("a"))
+	assert.False(t, s.Allow("a"))
+	s.Record("a", false, 0)
+	assert.Equal(t, Closed, s.State("a"))
+	assert.True(t, s.Allow("a"))
+}
+
+func isReady(ready <-chan struct{}) bool {
+	select {
+	case <-ready:
+		return true
+	default:
+		return false
+	}
+}
@@ -1,3 +1,253 @@
 package cache
 
-// TODO
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type RedisConfig struct {
+	Addr      string // host:port
+	Password  string // empty skips AUTH
+	DB        int
+	KeyPrefix string        // prepended to every key, lets several bots share a database
+	TTL       time.Duration // expiry of added keys, 0 keeps them until evicted by Redis
+
+	PoolSize     int           // open connections at most
+	DialTimeout  time.Duration // also the wait for a free connection of the pool
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+}
+
+var errPoolTimeout = errors.New("no free redis connection")
+
+// RedisError is an error reply of the server.
+type RedisError string
+
+func (e RedisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// RedisCache is a Cache kept in Redis, shared by every bot using the same
+// database and key prefix. Redis errors are logged and make Get miss and
+// Add do nothing: the bot works on without the cache.
+type RedisCache struct {
+	logger *zap.Logger
+	cfg    RedisConfig
+
+	slots  chan struct{}   // one per open or dialing connection
+	idle   chan *redisConn // connections to reuse
+	closed atomic.Bool
+}
+
+// NewRedisCache checks that the server answers before returning.
+func NewRedisCache(logger *zap.Logger, cfg RedisConfig) (*RedisCache, error) {
+	if cfg.PoolSize < 1 {
+		cfg.PoolSize = 1
+	}
+
+	c := &RedisCache{
+		logger: logger.Named("redis-cache"),
+		cfg:    cfg,
+		slots:  make(chan struct{}, cfg.PoolSize),
+		idle:   make(chan *redisConn, cfg.PoolSize),
+	}
+
+	if _, _, err := c.do("PING"); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("error in ping redis %s: %w", cfg.Addr, err)
+	}
+	return c, nil
+}
+
+// Add stores the value; it never reports an eviction.
+func (c *RedisCache) Add(key, value string) bool {
+	args := []string{"SET", c.cfg.KeyPrefix + key, value}
+	if c.cfg.TTL > 0 {
+		args = append(args, "PX", strconv.FormatInt(c.cfg.TTL.Milliseconds(), 10))
+	}
+
+	if _, _, err := c.do(args...); err != nil {
+		c.logger.Warn("Failed to add to redis cache", zap.String("key", key), zap.Error(err))
+	}
+	return false
+}
+
+func (c *RedisCache) Get(key string) (string, bool) {
+	value, ok, err := c.do("GET", c.cfg.KeyPrefix+key)
+	if err != nil {
+		c.logger.Warn("Failed to get from redis cache", zap.String("key", key), zap.Error(err))
+		return "", false
+	}
+	return value, ok
+}
+
+// Close closes the idle connections; the ones in use are closed when they
+// are returned.
+func (c *RedisCache) Close() error {
+	c.closed.Store(true)
+	for {
+		select {
+		case conn := <-c.idle:
+			_ = conn.Close()
+			<-c.slots
+		default:
+			return nil
+		}
+	}
+}
+
+// do sends a command and returns a string reply, false for a nil one.
+func (c *RedisCache) do(args ...string) (string, bool, error) {
+	conn, err := c.get()
+	if err != nil {
+		return "", false, err
+	}
+
+	reply, ok, err := conn.do(c.cfg, args)
+	var redisErr RedisError
+	c.put(conn, err != nil && !errors.As(err, &redisErr))
+	return reply, ok, err
+}
+
+func (c *RedisCache) get() (*redisConn, error) {
+	select {
+	case conn := <-c.idle:
+		return conn, nil
+	default:
+	}
+
+	var timeout <-chan time.Time
+	if c.cfg.DialTimeout > 0 {
+		timer := time.NewTimer(c.cfg.DialTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case conn := <-c.idle:
+		return conn, nil
+	case c.slots <- struct{}{}:
+	case <-timeout:
+		return nil, errPoolTimeout
+	}
+
+	conn, err := c.dial()
+	if err != nil {
+		<-c.slots
+		return nil, err
+	}
+	return conn, nil
+}
+
+// put returns a connection to the pool, a broken one is closed.
+func (c *RedisCache) put(conn *redisConn, broken bool) {
+	if broken || c.closed.Load() {
+		_ = conn.Close()
+		<-c.slots
+		return
+	}
+	c.idle <- conn
+}
+
+func (c *RedisCache) dial() (*redisConn, error) {
+	netConn, err := net.DialTimeout("tcp", c.cfg.Addr, c.cfg.DialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("error in dial redis: %w", err)
+	}
+	conn := &redisConn{Conn: netConn, r: bufio.NewReader(netConn), w: bufio.NewWriter(netConn)}
+
+	if c.cfg.Password != "" {
+		if _, _, err := conn.do(c.cfg, []string{"AUTH", c.cfg.Password}); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("error in redis auth: %w", err)
+		}
+	}
+	if c.cfg.DB != 0 {
+		if _, _, err := conn.do(c.cfg, []string{"SELECT", strconv.Itoa(c.cfg.DB)}); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("error in select redis db: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// do writes a command as a RESP array of bulk strings and reads the reply.
+func (conn *redisConn) do(cfg RedisConfig, args []string) (string, bool, error) {
+	if err := conn.SetWriteDeadline(deadline(cfg.WriteTimeout)); err != nil {
+		return "", false, err
+	}
+	fmt.Fprintf(conn.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(conn.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := conn.w.Flush(); err != nil {
+		return "", false, fmt.Errorf("error in write redis command: %w", err)
+	}
+
+	if err := conn.SetReadDeadline(deadline(cfg.ReadTimeout)); err != nil {
+		return "", false, err
+	}
+	return conn.readReply()
+}
+
+func (conn *redisConn) readReply() (string, bool, error) {
+	line, err := conn.readLine()
+	if err != nil {
+		return "", false, err
+	}
+
+	switch line[0] {
+	case '+', ':':
+		return line[1:], true, nil
+	case '-':
+		return "", false, RedisError(line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return "", false, fmt.Errorf("invalid redis bulk length %q", line)
+		}
+		if n < 0 {
+			return "", false, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(conn.r, buf); err != nil {
+			return "", false, fmt.Errorf("error in read redis reply: %w", err)
+		}
+		return string(buf[:n]), true, nil
+	default:
+		return "", false, fmt.Errorf("unexpected redis reply %q", line)
+	}
+}
+
+func (conn *redisConn) readLine() (string, error) {
+	line, err := conn.r.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("error in read redis reply: %w", err)
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("invalid redis reply line %q", line)
+	}
+	return line[:len(line)-2], nil
+}
+
+// deadline is zero, no deadline, for a zero timeout.
+func deadline(timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
@@ -1 +1,287 @@
 package cache
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// fakeRedis speaks enough RESP for RedisCache: PING, AUTH, SELECT, GET and
+// SET with PX.
+type fakeRedis struct {
+	listener net.Listener
+	password string
+	delay    atomic.Int64 // before every reply, a time.Duration
+
+	mu      sync.Mutex
+	data    map[string]string
+	expires map[string]time.Time
+	dbs     []string // SELECT arguments
+
+	conns atomic.Int32
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	f := &fakeRedis{
+		listener: listener,
+		password: password,
+		data:     make(map[string]string),
+		expires:  make(map[string]time.Time),
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			f.conns.Add(1)
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) addr() string {
+	return f.listener.Addr().String()
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authed := f.password == ""
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		time.Sleep(time.Duration(f.delay.Load()))
+
+		reply := f.handle(args, &authed)
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) handle(args []string, authed *bool) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	cmd := strings.ToUpper(args[0])
+	if cmd == "AUTH" {
+		if args[1] != f.password {
+			return "-WRONGPASS invalid password\r\n"
+		}
+		*authed = true
+		return "+OK\r\n"
+	}
+	if !*authed {
+		return "-NOAUTH Authentication required.\r\n"
+	}
+
+	switch cmd {
+	case "PING":
+		return "+PONG\r\n"
+	case "SELECT":
+		f.dbs = append(f.dbs, args[1])
+		return "+OK\r\n"
+	case "SET":
+		f.data[args[1]] = args[2]
+		delete(f.expires, args[1])
+		if len(args) == 5 && strings.ToUpper(args[3]) == "PX" {
+			ms, _ := strconv.Atoi(args[4])
+			f.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		}
+		return "+OK\r\n"
+	case "GET":
+		value, ok := f.data[args[1]]
+		if expires, set := f.expires[args[1]]; set && time.Now().After(expires) {
+			ok = false
+		}
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	default:
+		return "-ERR unknown command '" + args[0] + "'\r\n"
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func testRedisConfig(addr string) RedisConfig {
+	return RedisConfig{
+		Addr:         addr,
+		KeyPrefix:    "vtt:",
+		PoolSize:     2,
+		DialTimeout:  time.Second,
+		ReadTimeout:  time.Second,
+		WriteTimeout: time.Second,
+	}
+}
+
+func TestRedisCacheAddGet(t *testing.T) {
+	server := newFakeRedis(t, "")
+	c, err := NewRedisCache(zap.NewNop(), testRedisConfig(server.addr()))
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, ok := c.Get("missing")
+	assert.False(t, ok)
+
+	value := "строка\r\nwith a line break"
+	assert.False(t, c.Add("file_id:abc", value))
+
+	got, ok := c.Get("file_id:abc")
+	assert.True(t, ok)
+	assert.Equal(t, value, got)
+
+	server.mu.Lock()
+	assert.Contains(t, server.data, "vtt:file_id:abc", "keys get the prefix")
+	assert.Empty(t, server.expires, "no TTL configured")
+	server.mu.Unlock()
+}
+
+func TestRedisCacheTTL(t *testing.T) {
+	server := newFakeRedis(t, "")
+	cfg := testRedisConfig(server.addr())
+	cfg.TTL = 50 * time.Millisecond
+	c, err := NewRedisCache(zap.NewNop(), cfg)
+	require.NoError(t, err)
+	defer c.Close()
+
+	c.Add("key", "value")
+	_, ok := c.Get("key")
+	assert.True(t, ok)
+
+	time.Sleep(80 * time.Millisecond)
+	_, ok = c.Get("key")
+	assert.False(t, ok, "the key expired")
+}
+
+func TestRedisCacheAuthAndDB(t *testing.T) {
+	server := newFakeRedis(t, "secret")
+
+	cfg := testRedisConfig(server.addr())
+	_, err := NewRedisCache(zap.NewNop(), cfg)
+	assert.ErrorContains(t, err, "NOAUTH")
+
+	cfg.Password = "wrong"
+	_, err = NewRedisCache(zap.NewNop(), cfg)
+	assert.ErrorContains(t, err, "WRONGPASS")
+
+	cfg.Password = "secret"
+	cfg.DB = 3
+	c, err := NewRedisCache(zap.NewNop(), cfg)
+	require.NoError(t, err)
+	defer c.Close()
+
+	c.Add("key", "value")
+	got, ok := c.Get("key")
+	assert.True(t, ok)
+	assert.Equal(t, "value", got)
+
+	server.mu.Lock()
+	assert.Equal(t, []string{"3"}, server.dbs)
+	server.mu.Unlock()
+}
+
+func TestRedisCachePool(t *testing.T) {
+	server := newFakeRedis(t, "")
+	server.delay.Store(int64(5 * time.Millisecond))
+	c, err := NewRedisCache(zap.NewNop(), testRedisConfig(server.addr()))
+	require.NoError(t, err)
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key := strconv.Itoa(i)
+			c.Add(key, key)
+			got, ok := c.Get(key)
+			assert.True(t, ok)
+			assert.Equal(t, key, got)
+		}()
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, server.conns.Load(), int32(2), "connections are reused up to the pool size")
+}
+
+func TestRedisCacheTimeout(t *testing.T) {
+	server := newFakeRedis(t, "")
+	cfg := testRedisConfig(server.addr())
+	cfg.ReadTimeout = 20 * time.Millisecond
+	c, err := NewRedisCache(zap.NewNop(), cfg)
+	require.NoError(t, err)
+	defer c.Close()
+
+	server.delay.Store(int64(200 * time.Millisecond))
+
+	start := time.Now()
+	_, ok := c.Get("key")
+	assert.False(t, ok)
+	assert.Less(t, time.Since(start), 150*time.Millisecond)
+
+	server.delay.Store(0)
+	c.Add("key", "value")
+	got, ok := c.Get("key")
+	assert.True(t, ok, "a timed out connection is replaced")
+	assert.Equal(t, "value", got)
+}
+
+func TestRedisCacheUnavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	_, err = NewRedisCache(zap.NewNop(), testRedisConfig(addr))
+	assert.Error(t, err)
+}
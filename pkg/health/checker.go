@@ -0,0 +1,169 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type Config struct {
+	Interval         time.Duration
+	Timeout          time.Duration
+	FailureThreshold int // consecutive failed probes before a target is marked unhealthy
+	SuccessThreshold int // consecutive successful probes before it is marked healthy again
+}
+
+type ProbeFunc func(ctx context.Context, target string) error
+
+type Checker struct {
+	logger *zap.Logger
+	cfg    Config
+	probe  ProbeFunc
+
+	mu      sync.Mutex
+	targets map[string]*targetState
+
+	wg   sync.WaitGroup
+	stop chan struct{}
+}
+
+type targetState struct {
+	healthy   bool
+	failures  int
+	successes int
+	ready     chan struct{} // closed while the target is healthy
+}
+
+func NewChecker(logger *zap.Logger, cfg Config, probe ProbeFunc, targets []string) *Checker {
+	if cfg.FailureThreshold < 1 {
+		cfg.FailureThreshold = 1
+	}
+	if cfg.SuccessThreshold < 1 {
+		cfg.SuccessThreshold = 1
+	}
+
+	c := &Checker{
+		logger:  logger.Named("health"),
+		cfg:     cfg,
+		probe:   probe,
+		targets: make(map[string]*targetState, len(targets)),
+	}
+
+	for _, target := range targets {
+		ready := make(chan struct{})
+		close(ready)
+		c.targets[target] = &targetState{healthy: true, ready: ready}
+	}
+
+	return c
+}
+
+func (c *Checker) Start(ctx context.Context) {
+	c.stop = make(chan struct{})
+
+	c.logger.Info("starting health checks",
+		zap.Int("targets", len(c.targets)),
+		zap.Duration("interval", c.cfg.Interval),
+		zap.Int("failure_threshold", c.cfg.FailureThreshold),
+		zap.Int("success_threshold", c.cfg.SuccessThreshold))
+
+	c.wg.Add(len(c.targets))
+	for target := range c.targets {
+		go c.run(ctx, target)
+	}
+}
+
+func (c *Checker) Stop() {
+	close(c.stop)
+	c.wg.Wait()
+}
+
+// Ready returns a channel that is closed while target is healthy.
+// Unknown targets are always ready.
+func (c *Checker) Ready(target string) <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if st, ok := c.targets[target]; ok {
+		return st.ready
+	}
+
+	ready := make(chan struct{})
+	close(ready)
+	return ready
+}
+
+func (c *Checker) Available(target string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st, ok := c.targets[target]
+	return !ok || st.healthy
+}
+
+func (c *Checker) run(ctx context.Context, target string) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		c.check(ctx, target)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Checker) check(ctx context.Context, target string) {
+	probeCtx := ctx
+	if c.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		probeCtx, cancel = context.WithTimeout(ctx, c.cfg.Timeout)
+		defer cancel()
+	}
+
+	err := c.probe(probeCtx, target)
+	if ctx.Err() != nil {
+		return
+	}
+
+	c.report(target, err)
+}
+
+func (c *Checker) report(target string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st := c.targets[target]
+	log := c.logger.With(zap.String("target", target))
+
+	if err != nil {
+		st.successes = 0
+		st.failures++
+		log.Debug("health probe failed", zap.Int("failures", st.failures), zap.Error(err))
+
+		if st.healthy && st.failures >= c.cfg.FailureThreshold {
+			st.healthy = false
+			st.ready = make(chan struct{})
+			log.Warn("target marked unhealthy", zap.Int("failures", st.failures), zap.Error(err))
+		}
+		return
+	}
+
+	st.failures = 0
+	st.successes++
+
+	if !st.healthy && st.successes >= c.cfg.SuccessThreshold {
+		st.healthy = true
+		close(st.ready)
+		log.Info("target recovered", zap.Int("successes", st.successes))
+	}
+}
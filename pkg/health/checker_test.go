@@ -0,0 +1,72 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestThresholds(t *testing.T) {
+	c := NewChecker(zap.NewNop(), Config{FailureThreshold: 2, SuccessThreshold: 2}, nil, []string{"a"})
+	probeErr := errors.New("down")
+
+	assert.True(t, c.Available("a"))
+	assert.True(t, isClosed(c.Ready("a")))
+
+	c.report("a", probeErr)
+	assert.True(t, c.Available("a"), "one failure is below threshold")
+
+	c.report("a", probeErr)
+	assert.False(t, c.Available("a"))
+	ready := c.Ready("a")
+	assert.False(t, isClosed(ready))
+
+	c.report("a", nil)
+	assert.False(t, c.Available("a"), "one success is below threshold")
+
+	c.report("a", nil)
+	assert.True(t, c.Available("a"))
+	assert.True(t, isClosed(ready), "waiters must be released on recovery")
+}
+
+func TestUnknownTargetIsReady(t *testing.T) {
+	c := NewChecker(zap.NewNop(), Config{}, nil, nil)
+
+	assert.True(t, c.Available("x"))
+	assert.True(t, isClosed(c.Ready("x")))
+}
+
+func TestProbing(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+
+	probe := func(ctx context.Context, target string) error {
+		if down.Load() {
+			return errors.New("down")
+		}
+		return nil
+	}
+
+	c := NewChecker(zap.NewNop(), Config{Interval: 5 * time.Millisecond, FailureThreshold: 1}, probe, []string{"a"})
+	c.Start(context.Background())
+	defer c.Stop()
+
+	assert.Eventually(t, func() bool { return !c.Available("a") }, time.Second, time.Millisecond)
+
+	down.Store(false)
+	assert.Eventually(t, func() bool { return c.Available("a") }, time.Second, time.Millisecond)
+}
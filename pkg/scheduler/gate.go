@@ -0,0 +1,35 @@
+package scheduler
+
+// WorkerGate tells a worker when it may take tasks: Ready returns a channel
+// that is closed while the worker is allowed to run.
+type WorkerGate[K any] interface {
+	Ready(workerID K) <-chan struct{}
+}
+
+type allGates[K any] []WorkerGate[K]
+
+// AllGates combines gates: a worker is ready only if every gate is ready.
+func AllGates[K any](gates ...WorkerGate[K]) WorkerGate[K] {
+	return allGates[K](gates)
+}
+
+func (a allGates[K]) Ready(workerID K) <-chan struct{} {
+	for _, gate := range a {
+		if ready := gate.Ready(workerID); !isReady(ready) {
+			return ready
+		}
+	}
+
+	ready := make(chan struct{})
+	close(ready)
+	return ready
+}
+
+func isReady(ready <-chan struct{}) bool {
+	select {
+	case <-ready:
+		return true
+	default:
+		return false
+	}
+}
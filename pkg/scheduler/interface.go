@@ -1,7 +1,9 @@
 package scheduler
 
+import "context"
+
 type NamedWorkerScheduler[K any] interface {
 	Start(workersID []K)
-	Schedule(func(workerID K)) chan struct{}
+	Schedule(ctx context.Context, task func(workerID K)) chan struct{}
 	Stop()
 }
@@ -9,6 +9,7 @@ import (
 
 type NamedWorkerSchedulerQueue[K any] struct {
 	taskQueue queue.Queue[func(K)]
+	gate      WorkerGate[K]
 
 	wg   sync.WaitGroup
 	ctx  context.Context
@@ -22,6 +23,11 @@ func NewNamedWorkerSchedulerQueue[K any](ctx context.Context, queue queue.Queue[
 	}
 }
 
+// SetGate must be called before Start.
+func (n *NamedWorkerSchedulerQueue[K]) SetGate(gate WorkerGate[K]) {
+	n.gate = gate
+}
+
 func (n *NamedWorkerSchedulerQueue[K]) Start(workersID []K) {
 	n.stop = make(chan struct{})
 
@@ -31,11 +37,14 @@ func (n *NamedWorkerSchedulerQueue[K]) Start(workersID []K) {
 	}
 }
 
-func (n *NamedWorkerSchedulerQueue[K]) Schedule(task func(workerID K)) chan struct{} {
+func (n *NamedWorkerSchedulerQueue[K]) Schedule(ctx context.Context, task func(workerID K)) chan struct{} {
 	done := make(chan struct{})
 
 	n.taskQueue.Push(func(workerID K) {
 		defer close(done)
+		if ctx.Err() != nil {
+			return // caller is no longer waiting
+		}
 		task(workerID)
 	})
 
@@ -51,12 +60,26 @@ func (n *NamedWorkerSchedulerQueue[K]) worker(workerID K) {
 	defer n.wg.Done()
 
 	for {
+		if n.gate != nil {
+			select {
+			case <-n.ctx.Done():
+				return
+			case <-n.stop:
+				return
+			case <-n.gate.Ready(workerID):
+			}
+		}
+
 		select {
 		case <-n.ctx.Done():
 			return
 		case <-n.stop:
 			return
 		case task := <-n.taskQueue.Pop():
+			if n.gate != nil && !isReady(n.gate.Ready(workerID)) {
+				n.taskQueue.Push(task) // gate closed while waiting, leave the task to others
+				continue
+			}
 			task(workerID)
 		}
 	}
@@ -59,7 +59,7 @@ func TestSchedule(t *testing.T) {
 	workersID := []string{"worker1"}
 	scheduler.Start(workersID)
 
-	done := scheduler.Schedule(func(string) {
+	done := scheduler.Schedule(ctx, func(string) {
 		time.Sleep(time.Second)
 	})
 
@@ -93,7 +93,7 @@ func TestSchedul(t *testing.T) {
 	doneChans := make([]chan struct{}, 0, 10)
 
 	for range 10000 {
-		done := scheduler.Schedule(func(workerID string) {
+		done := scheduler.Schedule(ctx, func(workerID string) {
 			mu.Lock()
 			executedWorkers[workerID]++
 			mu.Unlock()
@@ -129,7 +129,7 @@ func TestScheduleMultipleWorkers(t *testing.T) {
 	doneChans := make([]chan struct{}, 0, 10)
 
 	for range 2 {
-		done := scheduler.Schedule(func(workerID string) {
+		done := scheduler.Schedule(ctx, func(workerID string) {
 			mu.Lock()
 			executedWorkers[workerID]++
 			mu.Unlock()
@@ -164,7 +164,7 @@ func TestStop(t *testing.T) {
 	scheduler.Start(workersID)
 	scheduler.Stop()
 
-	done := scheduler.Schedule(func(workerID string) {
+	done := scheduler.Schedule(ctx, func(workerID string) {
 		t.Fatal("Task should not be executed after Stop")
 	})
 
@@ -203,7 +203,7 @@ func TestContextCancel(t *testing.T) {
 
 	cancel()
 
-	done := scheduler.Schedule(func(workerID string) {
+	done := scheduler.Schedule(ctx, func(workerID string) {
 		t.Fatal("Task should not be executed after context cancellation")
 	})
 
@@ -234,7 +234,7 @@ func TestGenericType(t *testing.T) {
 	scheduler.Start(workersID)
 
 	var receivedWorkerID int
-	done := scheduler.Schedule(func(workerID int) {
+	done := scheduler.Schedule(ctx, func(workerID int) {
 		receivedWorkerID = workerID
 	})
 
@@ -247,3 +247,66 @@ func TestGenericType(t *testing.T) {
 
 	scheduler.Stop()
 }
+
+func TestScheduleCanceledTask(t *testing.T) {
+	ctx := context.Background()
+	queue := NewMockQueue[func(string)]()
+	scheduler := NewNamedWorkerSchedulerQueue(ctx, queue)
+
+	taskCtx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	done := scheduler.Schedule(taskCtx, func(string) {
+		t.Fatal("Task should not be executed after task context cancellation")
+	})
+
+	scheduler.Start([]string{"worker1"})
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Canceled task was not dropped within 1 second")
+	}
+
+	scheduler.Stop()
+}
+
+type chanGate map[string]chan struct{}
+
+func (g chanGate) Ready(workerID string) <-chan struct{} {
+	return g[workerID]
+}
+
+func TestGateSkipsClosedWorker(t *testing.T) {
+	ctx := context.Background()
+	queue := NewMockQueue[func(string)]()
+	scheduler := NewNamedWorkerSchedulerQueue(ctx, queue)
+
+	open := make(chan struct{})
+	close(open)
+	scheduler.SetGate(chanGate{"up": open, "down": make(chan struct{})})
+	scheduler.Start([]string{"up", "down"})
+
+	var mu sync.Mutex
+	executedWorkers := make(map[string]int)
+	for range 100 {
+		done := scheduler.Schedule(ctx, func(workerID string) {
+			mu.Lock()
+			executedWorkers[workerID]++
+			mu.Unlock()
+		})
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Task was not executed within 1 second")
+		}
+	}
+
+	mu.Lock()
+	assert.Equal(t, 100, executedWorkers["up"])
+	assert.Equal(t, 0, executedWorkers["down"])
+	mu.Unlock()
+
+	scheduler.Stop()
+}
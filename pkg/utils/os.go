@@ -1,6 +1,9 @@
 package utils
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
@@ -10,8 +13,13 @@ import (
 	"go.uber.org/zap"
 )
 
-func DownloadFile(logger *zap.Logger, url, fileName string) (string, error) {
-	resp, err := http.Get(url)
+func DownloadFile(ctx context.Context, logger *zap.Logger, url, fileName string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("error in create request: [file url: %s] %v", url, err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("error in download file: [file url: %s] %v", url, err)
 	}
@@ -30,3 +38,18 @@ func DownloadFile(logger *zap.Logger, url, fileName string) (string, error) {
 
 	return filePath, nil
 }
+
+// FileSHA256 returns the hex SHA-256 of the file content.
+func FileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("error in open file: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("error in read file: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSHA256(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audio.ogg")
+	require.NoError(t, os.WriteFile(path, []byte("abc"), 0o644))
+
+	hash, err := FileSHA256(path)
+	require.NoError(t, err)
+	assert.Equal(t, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", hash)
+
+	_, err = FileSHA256(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,50 @@
+package utils
+
+import "strings"
+
+// CleanPunctuation tidies up the punctuation of recognized speech, line by
+// line: runs of spaces become one, spaces before punctuation marks are
+// removed, repeated marks are collapsed and three or more dots become an
+// ellipsis. Line breaks are kept.
+func CleanPunctuation(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = cleanLine(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func cleanLine(line string) string {
+	runes := []rune(strings.Join(strings.Fields(line), " "))
+
+	out := make([]rune, 0, len(runes))
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		if r == '.' {
+			n := 1
+			for i+n < len(runes) && runes[i+n] == '.' {
+				n++
+			}
+			i += n - 1
+			if n >= 3 {
+				r = '…'
+			}
+		}
+
+		if isPunctuationMark(r) {
+			if len(out) > 0 && out[len(out)-1] == ' ' {
+				out = out[:len(out)-1]
+			}
+			if r != '…' && len(out) > 0 && out[len(out)-1] == r {
+				continue
+			}
+		}
+		out = append(out, r)
+	}
+	return string(out)
+}
+
+func isPunctuationMark(r rune) bool {
+	return strings.ContainsRune(",.!?;:…", r)
+}
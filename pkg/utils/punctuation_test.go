@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanPunctuation(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Привет , как  дела ?", "Привет, как дела?"},
+		{"Ну...   ладно.. хорошо!!!", "Ну… ладно. хорошо!"},
+		{"да,, нет ;; может", "да, нет; может"},
+		{"В 10:30 было 3.14 .", "В 10:30 было 3.14."},
+		{"[00:01]  раз ,\n[00:05] два", "[00:01] раз,\n[00:05] два"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, CleanPunctuation(tt.text), tt.text)
+	}
+}
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// MaxMessageLength is the Telegram limit for a message text, in UTF-16 code units.
+const MaxMessageLength = 4096
+
+// TextLength returns the length of text as Telegram counts it: in UTF-16 code units.
+func TextLength(text string) int {
+	n := 0
+	for _, r := range text {
+		n += runeLength(r)
+	}
+	return n
+}
+
+func runeLength(r rune) int {
+	if r >= 0x10000 {
+		return 2 // surrogate pair
+	}
+	return 1
+}
+
+// SplitText cuts text into parts of at most limit UTF-16 code units. A part
+// ends at the last sentence end or line break that keeps it at least half
+// full, otherwise at the last space, and only as a last resort inside a word.
+// Runes are never cut.
+func SplitText(text string, limit int) []string {
+	text = strings.TrimSpace(text)
+	if limit <= 0 || TextLength(text) <= limit {
+		return []string{text}
+	}
+
+	var parts []string
+	runes := []rune(text)
+	for len(runes) > 0 {
+		cut := cutIndex(runes, limit)
+		if part := strings.TrimSpace(string(runes[:cut])); part != "" {
+			parts = append(parts, part)
+		}
+		runes = runes[cut:]
+	}
+	return parts
+}
+
+// cutIndex returns how many runes of runes go into the next part.
+func cutIndex(runes []rune, limit int) int {
+	fit, length := 0, 0
+	for fit < len(runes) && length+runeLength(runes[fit]) <= limit {
+		length += runeLength(runes[fit])
+		fit++
+	}
+	if fit == len(runes) {
+		return fit
+	}
+	if fit == 0 { // limit is smaller than a single rune
+		return 1
+	}
+
+	// boundaries at fit itself: the next rune is a space or a line break
+	sentence, space := 0, 0
+	if unicode.IsSpace(runes[fit]) {
+		space = fit
+		if runes[fit] == '\n' || isSentenceEnd(runes[fit-1]) {
+			sentence = fit
+		}
+	}
+
+	for i := fit; i > 0 && sentence == 0; i-- {
+		r := runes[i-1]
+		if !unicode.IsSpace(r) {
+			continue
+		}
+		if space == 0 {
+			space = i
+		}
+		if r == '\n' || (i >= 2 && isSentenceEnd(runes[i-2])) {
+			sentence = i
+		}
+	}
+
+	switch {
+	case sentence > 0 && sentence >= fit/2:
+		return sentence
+	case space > 0:
+		return space
+	default:
+		return fit
+	}
+}
+
+func isSentenceEnd(r rune) bool {
+	return strings.ContainsRune(".!?…", r)
+}
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitTextShort(t *testing.T) {
+	assert.Equal(t, []string{"привет"}, SplitText(" привет ", 10))
+	assert.Equal(t, []string{""}, SplitText("", 10))
+}
+
+func TestSplitTextSentences(t *testing.T) {
+	text := "Первое предложение. Второе предложение! Третье?"
+
+	assert.Equal(t, []string{"Первое предложение.", "Второе предложение!", "Третье?"},
+		SplitText(text, 25))
+	assert.Equal(t, []string{"Первое предложение. Второе предложение!", "Третье?"},
+		SplitText(text, 40))
+}
+
+func TestSplitTextWords(t *testing.T) {
+	// the only sentence end is too early, so the part ends at a space
+	text := "Да. один два три четыре пять"
+
+	assert.Equal(t, []string{"Да. один два", "три четыре", "пять"}, SplitText(text, 12))
+}
+
+func TestSplitTextLongWord(t *testing.T) {
+	assert.Equal(t, []string{"абв", "где", "ё"}, SplitText("абвгдеё", 3))
+}
+
+func TestSplitTextSurrogatePairs(t *testing.T) {
+	text := strings.Repeat("😀", 5)
+	parts := SplitText(text, 4)
+
+	assert.Equal(t, []string{"😀😀", "😀😀", "😀"}, parts)
+	for _, part := range parts {
+		assert.True(t, utf8.ValidString(part))
+		assert.LessOrEqual(t, TextLength(part), 4)
+	}
+}
+
+func TestSplitTextKeepsAllWords(t *testing.T) {
+	text := strings.Repeat("Слово за словом. ", 1000)
+	parts := SplitText(text, MaxMessageLength)
+
+	assert.Len(t, parts, 5)
+	for _, part := range parts {
+		assert.LessOrEqual(t, TextLength(part), MaxMessageLength)
+		assert.True(t, strings.HasSuffix(part, "."))
+	}
+	assert.Equal(t, strings.Fields(text), strings.Fields(strings.Join(parts, " ")))
+}
@@ -10,7 +10,7 @@ func SendTextReply(bot *tgbotapi.BotAPI, chatID int64, replyToMessageID int, tex
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.ReplyToMessageID = replyToMessageID
 	if _, err := bot.Send(msg); err != nil {
-		return fmt.Errorf("error in sending the text: [text: %s] %v", text, err)
+		return fmt.Errorf("error in sending the text: [text: %s] %w", text, err)
 	}
 	return nil
 }
@@ -18,7 +18,46 @@ func SendTextReply(bot *tgbotapi.BotAPI, chatID int64, replyToMessageID int, tex
 func EditMessage(bot *tgbotapi.BotAPI, chatID int64, messageID int, text string) error {
 	editMsg := tgbotapi.NewEditMessageText(chatID, messageID, text)
 	if _, err := bot.Send(editMsg); err != nil {
-		return fmt.Errorf("error in editing message: [text: %s] %v", text, err)
+		return fmt.Errorf("error in editing message: [text: %s] %w", text, err)
+	}
+	return nil
+}
+
+func EditMessageWithKeyboard(bot *tgbotapi.BotAPI, chatID int64, messageID int, text string, keyboard tgbotapi.InlineKeyboardMarkup) error {
+	editMsg := tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, text, keyboard)
+	if _, err := bot.Send(editMsg); err != nil {
+		return fmt.Errorf("error in editing message: [text: %s] %w", text, err)
+	}
+	return nil
+}
+
+func SendDocumentReply(bot *tgbotapi.BotAPI, chatID int64, replyToMessageID int, fileName string, data []byte) error {
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: fileName, Bytes: data})
+	doc.ReplyToMessageID = replyToMessageID
+	if _, err := bot.Send(doc); err != nil {
+		return fmt.Errorf("error in sending the document: [file name: %s] %w", fileName, err)
+	}
+	return nil
+}
+
+func AnswerCallback(bot *tgbotapi.BotAPI, callbackID, text string) error {
+	if _, err := bot.Request(tgbotapi.NewCallback(callbackID, text)); err != nil {
+		return fmt.Errorf("error in answering callback: [text: %s] %w", text, err)
+	}
+	return nil
+}
+
+// SendThreadedReplies sends parts one by one, each as a reply to the previous
+// one, starting with a reply to replyToMessageID.
+func SendThreadedReplies(bot *tgbotapi.BotAPI, chatID int64, replyToMessageID int, parts []string) error {
+	for i, part := range parts {
+		msg := tgbotapi.NewMessage(chatID, part)
+		msg.ReplyToMessageID = replyToMessageID
+		sent, err := bot.Send(msg)
+		if err != nil {
+			return fmt.Errorf("error in sending part %d of %d: %w", i+1, len(parts), err)
+		}
+		replyToMessageID = sent.MessageID
 	}
 	return nil
 }